@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jpillora/opts"
+	"github.com/jpillora/ssh-tron/tron"
+)
+
+var VERSION = "0.0.0-src"
+
+type config struct {
+	Strategies string `help:"Comma separated bot strategies to play against each other"`
+	Rounds     int    `help:"Number of rounds to play"`
+	Width      int    `help:"Width of the game world" min:"32" max:"512"`
+	Height     int    `help:"Height of the game world" min:"32" max:"512"`
+	Seed       int    `help:"Random seed, the same seed replays the same tournament (default is the current time)"`
+}
+
+func main() {
+
+	c := config{
+		Strategies: "flood-fill,wall-follow,random",
+		Rounds:     1000,
+		Width:      60,
+		Height:     60,
+	}
+
+	opts.New(&c).
+		PkgRepo().
+		Version(VERSION).
+		Parse()
+
+	seed := int64(c.Seed)
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	standings, err := tron.Tournament(strings.Split(c.Strategies, ","), c.Rounds, c.Width, c.Height, seed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		return standings[i].Wins > standings[j].Wins
+	})
+	fmt.Printf("%d rounds on %dx%d (seed %d)\n\n", c.Rounds, c.Width, c.Height, seed)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STRATEGY\tWINS\tDRAWS\tLOSSES\tWIN RATE")
+	for _, s := range standings {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.1f%%\n", s.Strategy, s.Wins, s.Draws, s.Losses,
+			100*float64(s.Wins)/float64(c.Rounds))
+	}
+	w.Flush()
+}
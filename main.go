@@ -16,14 +16,17 @@ var VERSION = "0.0.0-src"
 func main() {
 
 	c := tron.Config{
-		Port:       2200,
-		Width:      60,
-		Height:     60,
-		MaxPlayers: 6,
-		// Mode:         "kd",
-		// KickDeaths:   5,
+		Port:         2200,
+		Width:        60,
+		Height:       60,
+		MaxPlayers:   6,
+		Mode:         "kills",
 		GameSpeed:    40 * time.Millisecond,
 		RespawnDelay: 2 * time.Second,
+		KillCam:      true,
+		Viewport:     true,
+		BotStrategy:  "flood-fill",
+		BotTimeout:   20 * time.Millisecond,
 		DBLocation:   filepath.Join(os.TempDir(), "tron.db"),
 	}
 
@@ -34,9 +37,9 @@ func main() {
 
 	rand.Seed(time.Now().UnixNano())
 
-	g, err := tron.NewGame(c)
+	l, err := tron.NewLobby(c)
 	if err != nil {
 		log.Fatal(err)
 	}
-	g.Play()
+	l.Play()
 }
@@ -0,0 +1,348 @@
+package tron
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// bot strategies
+const (
+	strategyFloodFill  = "flood-fill"
+	strategyWallFollow = "wall-follow"
+	strategyRandom     = "random"
+)
+
+// maximum number of tiles counted by the flood-fill strategy
+const floodLimit = 1000
+
+// directions, for use by strategies
+const (
+	Up    = dup
+	Down  = ddown
+	Right = dright
+	Left  = dleft
+)
+
+// Strategy steers a bot. Steer is called by the game loop each
+// tick while the bot is alive, and returns its next direction.
+// Turning back on itself is ignored.
+type Strategy interface {
+	Steer(s *Snapshot) Direction
+}
+
+// Snapshot is a bot's read-only view of the game
+type Snapshot struct {
+	Width, Height int
+	Wrap          bool // edges lead to the opposite edge, instead of walls
+	Self          Cycle
+	Opponents     []Cycle
+	Rand          *rand.Rand // the cycle's own, seeded by the engine, for repeatable games
+	board         Board
+}
+
+// Cycle is a light cycle in a Snapshot
+type Cycle struct {
+	ID        ID
+	X, Y      int
+	Direction Direction
+	Alive     bool
+	Teammate  bool
+}
+
+// At returns the ID whose trail is at (x, y), 0 when the tile is
+// empty (or holds a power-up). Unless the board wraps, the board's
+// edges and anything beyond them are walls.
+func (s *Snapshot) At(x, y int) ID {
+	x, y = s.Wrapped(x, y)
+	if x < 0 || y < 0 || x >= s.Width || y >= s.Height {
+		return wall
+	}
+	if id := s.board[x][y]; !isItem(id) {
+		return id
+	}
+	return blank
+}
+
+// Free reports whether the tile at (x, y) is empty
+func (s *Snapshot) Free(x, y int) bool {
+	return s.At(x, y) == blank
+}
+
+// Wrapped returns (x, y) moved onto the board, when the board wraps
+func (s *Snapshot) Wrapped(x, y int) (int, int) {
+	if s.Wrap {
+		x = (x%s.Width + s.Width) % s.Width
+		y = (y%s.Height + s.Height) % s.Height
+	}
+	return x, y
+}
+
+// Ahead returns the tile one move from (x, y) in direction d
+func Ahead(x, y int, d Direction) (int, int) {
+	switch d {
+	case dup:
+		y--
+	case ddown:
+		y++
+	case dleft:
+		x--
+	case dright:
+		x++
+	}
+	return x, y
+}
+
+// Turns returns the directions to the left and right of d
+func (d Direction) Turns() (left, right Direction) {
+	switch d {
+	case dup:
+		return dleft, dright
+	case ddown:
+		return dright, dleft
+	case dleft:
+		return ddown, dup
+	}
+	return dup, ddown
+}
+
+var directions = []Direction{dup, ddown, dleft, dright}
+
+// choices are the directions a cycle may take next:
+// straight, then left, then right
+func choices(d Direction) []Direction {
+	l, r := d.Turns()
+	return []Direction{d, l, r}
+}
+
+// free reports whether moving from (x, y) in direction d is safe
+func (s *Snapshot) free(x, y int, d Direction) bool {
+	return s.Free(Ahead(x, y, d))
+}
+
+var strategies = struct {
+	sync.Mutex
+	m map[string]func() Strategy
+}{m: map[string]func() Strategy{
+	strategyFloodFill:  func() Strategy { return floodFill{} },
+	strategyWallFollow: func() Strategy { return wallFollow{} },
+	strategyRandom:     func() Strategy { return random{} },
+}}
+
+// RegisterStrategy makes a Strategy available to the --bot-strategy
+// option. fn is called once for each bot.
+func RegisterStrategy(name string, fn func() Strategy) {
+	strategies.Lock()
+	strategies.m[name] = fn
+	strategies.Unlock()
+}
+
+func newStrategy(name string) (Strategy, error) {
+	strategies.Lock()
+	fn, ok := strategies.m[name]
+	strategies.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown bot strategy: %s", name)
+	}
+	return fn(), nil
+}
+
+// newRobot returns a bot player, which has no connection
+func newRobot(s Strategy, name string) *Player {
+	p := NewPlayer(blank, name, name, "bot/"+name, nil)
+	p.ai = s
+	p.ready = true
+	return p
+}
+
+// fillBots adds bots while there are fewer players than configured, and
+// removes them when humans need their slots. called by the game loop.
+func (g *Game) fillBots() {
+	others, bots := 0, 0
+	for _, p := range g.currPlayers {
+		if p.filler {
+			bots++
+		} else {
+			others++
+		}
+	}
+	for bots > 0 && (bots > g.Bots-others || len(g.queue) > 0) {
+		g.removeBot()
+		bots--
+	}
+	for bots < g.Bots-others && len(g.queue) == 0 {
+		select {
+		case id := <-g.idPool:
+			g.addBot(id)
+			bots++
+		default:
+			return
+		}
+	}
+}
+
+// addBot places a new filler bot into the game with the given id
+func (g *Game) addBot(id ID) {
+	s, _ := newStrategy(g.BotStrategy)
+	name := botNames[g.BotStrategy]
+	if name == "" {
+		name = "bot"
+	}
+	p := newRobot(s, fmt.Sprintf("%s-%d", name, id))
+	p.filler = true
+	g.enter(p, id)
+	p.logf("bot joined")
+}
+
+// enter places a bot into the game with the given id
+func (g *Game) enter(p *Player, id ID) {
+	p.g = g
+	if g.BotStats {
+		g.db.load(p)
+	}
+	g.admit(p, id)
+	g.publish()
+}
+
+// short strategy names, used to name bots
+var botNames = map[string]string{
+	strategyFloodFill:  "flood",
+	strategyWallFollow: "wall",
+	strategyRandom:     "random",
+}
+
+// removeBot frees a filler bot's slot
+func (g *Game) removeBot() {
+	for _, p := range g.currPlayers {
+		if p.filler {
+			g.leave(p)
+			return
+		}
+	}
+}
+
+// steerBots respawns dead bots and asks the others
+// where to go next, in id order so games are repeatable.
+// called by the game loop.
+func (g *Game) steerBots() {
+	bots := []*Player{}
+	for id := ID(1); int(id) <= g.MaxPlayers; id++ {
+		p, ok := g.currPlayers[id]
+		if !ok || p.ai == nil {
+			continue
+		}
+		if p.dead {
+			p.respawn()
+			continue
+		}
+		bots = append(bots, p)
+	}
+	// bot programs think at once, so the loop waits for the
+	// slowest of them rather than all of them in turn
+	riders := g.riders()
+	deadline := time.Now().Add(g.BotTimeout)
+	snapshots := make([]*Snapshot, len(bots))
+	for i, p := range bots {
+		snapshots[i] = g.engine.snapshot(&p.rider, riders)
+		if t, ok := p.ai.(thinker); ok {
+			t.ask(snapshots[i], deadline)
+		}
+	}
+	for i, p := range bots {
+		d := p.ai.Steer(snapshots[i])
+		if f, ok := p.ai.(fallible); ok {
+			if err := f.failed(); err != nil {
+				g.disqualify(p, err)
+				continue
+			}
+		}
+		p.steer(d)
+	}
+}
+
+// random goes straight, turning at random or when blocked
+type random struct{}
+
+func (random) Steer(s *Snapshot) Direction {
+	me := s.Self
+	safe := []Direction{}
+	for _, d := range choices(me.Direction) {
+		if s.free(me.X, me.Y, d) {
+			safe = append(safe, d)
+		}
+	}
+	if len(safe) == 0 {
+		return me.Direction
+	}
+	if safe[0] == me.Direction && s.Rand.Intn(10) > 0 {
+		return me.Direction
+	}
+	return safe[s.Rand.Intn(len(safe))]
+}
+
+// wallFollow keeps a wall (or a trail) to its right
+type wallFollow struct{}
+
+func (wallFollow) Steer(s *Snapshot) Direction {
+	me := s.Self
+	l, r := me.Direction.Turns()
+	// prefer moves which stay alongside something
+	for _, d := range []Direction{r, me.Direction, l} {
+		if !s.free(me.X, me.Y, d) {
+			continue
+		}
+		x, y := Ahead(me.X, me.Y, d)
+		_, right := d.Turns()
+		if !s.free(x, y, right) {
+			return d
+		}
+	}
+	for _, d := range []Direction{me.Direction, r, l} {
+		if s.free(me.X, me.Y, d) {
+			return d
+		}
+	}
+	return me.Direction
+}
+
+// floodFill heads towards the most open space
+type floodFill struct{}
+
+func (floodFill) Steer(s *Snapshot) Direction {
+	me := s.Self
+	best, most := me.Direction, -1
+	for _, d := range choices(me.Direction) {
+		if !s.free(me.X, me.Y, d) {
+			continue
+		}
+		x, y := s.Wrapped(Ahead(me.X, me.Y, d))
+		if n := s.space(x, y); n > most {
+			best, most = d, n
+		}
+	}
+	return best
+}
+
+// space counts the empty tiles reachable from (x, y), up to floodLimit
+func (s *Snapshot) space(x, y int) int {
+	type tile struct{ x, y int }
+	seen := make([]bool, s.Width*s.Height)
+	seen[x*s.Height+y] = true
+	next := []tile{{x, y}}
+	n := 1
+	for len(next) > 0 && n < floodLimit {
+		t := next[0]
+		next = next[1:]
+		for _, d := range directions {
+			ax, ay := s.Wrapped(Ahead(t.x, t.y, d))
+			if !s.Free(ax, ay) || seen[ax*s.Height+ay] {
+				continue
+			}
+			seen[ax*s.Height+ay] = true
+			next = append(next, tile{ax, ay})
+			n++
+		}
+	}
+	return n
+}
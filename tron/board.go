@@ -7,12 +7,18 @@ const (
 	blank = ID(0x0000)
 )
 
+// board sizes, larger boards are shown through a viewport
+const (
+	minBoardSize = 32
+	maxBoardSize = 512
+)
+
 // Board represents a board in a game.
 // Each player has a board, which are used to send board deltas.
 type Board [][]ID
 
 // NewBoard returns an initialized Board.
-func NewBoard(width, height uint8) (Board, error) {
+func NewBoard(width, height int) (Board, error) {
 	if height%2 != 0 {
 		return nil, errors.New("height must be even")
 	}
@@ -20,9 +26,9 @@ func NewBoard(width, height uint8) (Board, error) {
 		return nil, errors.New("width must be even")
 	}
 	board := make([][]ID, width)
-	for w := uint8(0); w < width; w++ {
+	for w := 0; w < width; w++ {
 		board[w] = make([]ID, height)
-		for h := uint8(0); h < height; h++ {
+		for h := 0; h < height; h++ {
 			board[w][h] = blank
 		}
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"regexp"
+	"sync"
 
 	"github.com/nlopes/slack"
 )
@@ -12,9 +13,11 @@ const topNumPlayers = 10
 
 type Bot struct {
 	connected bool
+	mode      string
 	api       *slack.Client
 	channel   string
 	top       *Player
+	mut       sync.Mutex
 	scores    string
 }
 
@@ -49,21 +52,31 @@ func (b *Bot) scoreChange(ps []*Player) {
 		ps = ps[:topNumPlayers]
 	}
 	var top *Player
-	b.scores = ""
+	scores := ""
 	//keep rendered string of scores
 	for i, p := range ps {
-		if i == 0 && p.Kills > 0 {
+		v, unit := headline(b.mode, p)
+		if i == 0 && v > 0 {
 			top = p
 		}
-		b.scores += fmt.Sprintf("#%d *%s* `%d` kills\n", p.rank, p.SSHName, p.Kills)
+		scores += fmt.Sprintf("#%d *%s* `%d` %s\n", p.rank, p.SSHName, v, unit)
 	}
-	//if leader changed, send message
+	b.mut.Lock()
+	b.scores = scores
+	b.mut.Unlock()
+	//if leader changed, send message (dont block the game loop)
 	if top != nil && b.top != top && (b.top == nil || top.rank > b.top.rank) {
-		b.message("*" + top.SSHName + "* has taken the lead!\n\n" + b.scores)
+		go b.message("*" + top.SSHName + "* has taken the lead!\n\n" + scores)
 		b.top = top
 	}
 }
 
+func (b *Bot) currentScores() string {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.scores
+}
+
 func (b *Bot) start() {
 	rtm := b.api.NewRTM()
 	go rtm.ManageConnection()
@@ -74,12 +87,13 @@ func (b *Bot) start() {
 			case *slack.MessageEvent:
 				// log.Printf("%s, %s, %s", ev.Channel, ev.Text, ev.User)
 				if scoresRe.MatchString(ev.Text) {
+					scores := b.currentScores()
 					if ch, err := b.api.GetChannelInfo(ev.Channel); err == nil {
-						b.messageTo("#"+ch.Name, b.scores)
+						b.messageTo("#"+ch.Name, scores)
 					} else if us, err := b.api.GetUserInfo(ev.User); err == nil {
-						b.messageTo("@"+us.Name, b.scores)
+						b.messageTo("@"+us.Name, scores)
 					} else {
-						b.message(b.scores)
+						b.message(scores)
 					}
 				}
 			case *slack.RTMError:
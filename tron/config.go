@@ -4,11 +4,27 @@ import "time"
 
 type Config struct {
 	Port         int           `help:"Port to listen for TCP connections on" env:"PORT"`
-	Width        int           `help:"Width of the game world" min:"32" max:"256"`
-	Height       int           `help:"Height of the game world" min:"32" max:"256"`
+	Width        int           `help:"Width of the game world" min:"32" max:"512"`
+	Height       int           `help:"Height of the game world" min:"32" max:"512"`
 	MaxPlayers   int           `help:"Maximum number of simultaneous players"`
 	GameSpeed    time.Duration `help:"Game tick interval, basically controls how fast each player moves"`
 	RespawnDelay time.Duration `help:"The time a player must wait before being able to respawn"`
+	Map          string        `help:"Play on a map, built in (cross, pillars or maze) or a text or JSON map file, which sets the board size"`
+	Wrap         bool          `help:"Cycles leaving one edge of the board appear on the opposite edge, instead of hitting a wall"`
+	Mode         string        `help:"Score by players running into your trail (kills), by being the last cycle standing (elimination), or by creating the longest trail (trail)"`
+	KillLimit    int           `help:"End the round once a player reaches this many kills (0 disables rounds)"`
+	Teams        int           `help:"Split players into N teams, join a team with 'ssh name+red@host' (0 disables teams)"`
+	ResetOnDeath bool          `help:"Reset all players whenever anyone dies"`
+	PowerUps     bool          `help:"Drop power-ups on the board: speed (»), ghost (~), trail eraser bomb (*) and shield (+)"`
+	Viewport     bool          `help:"Show players whose terminal is too small for the board a window of it, which follows their cycle"`
+	KillCam      bool          `help:"Show players a replay of their death while they wait to respawn"`
+	KickDeaths   int           `help:"Punish bad players by kicking them out after N deaths in a row (0 disables kicking)"`
+	Bots         int           `help:"Fill empty slots with bots while there are fewer than N human players (0 disables bots)"`
+	BotStrategy  string        `help:"How bots steer, by maximising their space (flood-fill), by hugging walls (wall-follow), or randomly (random)"`
+	BotStats     bool          `help:"Save bot scores in the database"`
+	BotPrograms  string        `help:"Comma separated commands, each run as a bot which reads the game from stdin and writes its moves to stdout"`
+	BotTimeout   time.Duration `help:"Time limit for each move of a bot program, slower programs are disqualified"`
+	RecordDir    string        `help:"Save a replay of each round in this directory, watch them with 'ssh <host> replay'"`
 	DBLocation   string        `help:"Location of tron.db, stores game score and config"`
 	DBReset      bool          `help:"Reset all scores in the database"`
 	JoinAddress  string        `help:"A friendly DNS address to present to users"`
@@ -16,6 +32,9 @@ type Config struct {
 	SlackChannel string        `help:"Slack chatroom channel" env:"SLACK_CHANNEL"`
 }
 
-// TODO
-// KickDeaths   int           `help:"Punish bad players by kicking them out after N deaths in a row"`
-// Mode         string        `help:"Score by players running into your trail, or score by creating the longest trail"`
+// game modes
+const (
+	modeKills       = "kills"
+	modeElimination = "elimination"
+	modeTrail       = "trail"
+)
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 
 var (
 	playerBucket = []byte("players")
+	roundBucket  = []byte("rounds")
 	configBucket = []byte("config")
 	configSSHKey = []byte("ssh-private-key")
 )
@@ -24,6 +26,13 @@ var (
 //various game structs. disk or memory.
 type Database struct {
 	*bolt.DB
+	writes chan write
+}
+
+// write is a serialized value waiting to be saved,
+// a nil key will use the next sequence in the bucket
+type write struct {
+	bucket, key, val []byte
 }
 
 func NewDatabase(loc string, reset bool) (*Database, error) {
@@ -32,27 +41,67 @@ func NewDatabase(loc string, reset bool) (*Database, error) {
 		return nil, fmt.Errorf("Database error (%s)", err)
 	}
 	db := &Database{
-		DB: b,
+		DB:     b,
+		writes: make(chan write, 64),
 	}
 	if reset {
 		db.Update(func(tx *bolt.Tx) error {
+			tx.DeleteBucket(roundBucket)
 			return tx.DeleteBucket(playerBucket)
 		})
 	}
+	go db.writer()
 	return db, nil
 }
 
 func (db *Database) save(p *Player) error {
+	val, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return db.put(playerBucket, []byte(p.hash), val)
+}
+
+// saveAsync serializes the player immediately (from the game loop)
+// and leaves the disk write to the writer goroutine
+func (db *Database) saveAsync(p *Player) {
+	val, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	db.writes <- write{playerBucket, []byte(p.hash), val}
+}
+
+// saveRound appends the round result (from the game loop)
+func (db *Database) saveRound(r *roundResult) {
+	val, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	db.writes <- write{roundBucket, nil, val}
+}
+
+func (db *Database) writer() {
+	for w := range db.writes {
+		db.put(w.bucket, w.key, w.val)
+	}
+}
+
+func (db *Database) put(bucket, key, val []byte) error {
 	err := db.Update(func(tx *bolt.Tx) error {
-		ps, err := tx.CreateBucketIfNotExists(playerBucket)
+		b, err := tx.CreateBucketIfNotExists(bucket)
 		if err != nil {
 			return err
 		}
-		val, err := json.Marshal(p)
-		if err != nil {
-			return err
+		if key == nil {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			key = make([]byte, 8)
+			binary.BigEndian.PutUint64(key, seq)
 		}
-		if err := ps.Put([]byte(p.hash), val); err != nil {
+		if err := b.Put(key, val); err != nil {
 			return err
 		}
 		return nil
@@ -78,9 +127,12 @@ func (db *Database) load(p *Player) error {
 		if err := json.Unmarshal(val, &tmp); err != nil {
 			return err
 		}
-		//only load KDs
+		//only load scores
 		p.Kills = tmp.Kills
 		p.Deaths = tmp.Deaths
+		p.Wins = tmp.Wins
+		p.Points = tmp.Points
+		p.Best = tmp.Best
 		return nil
 	})
 	if err != nil {
@@ -90,6 +142,72 @@ func (db *Database) load(p *Player) error {
 	return nil
 }
 
+// prefs are a player's saved preferences, chosen in the lobby
+// or the game
+type prefs struct {
+	sshName, name string // for new players
+	colour        string
+	invert        bool
+}
+
+// prefs copies the player's preferences. spectators, who share
+// one name, are only saved once they've played.
+func (p *Player) prefs() prefs {
+	pr := prefs{p.SSHName, p.Name, p.Colour, p.Invert}
+	if p.spectating {
+		pr.sshName, pr.name = "", ""
+	}
+	return pr
+}
+
+// loadPrefs loads the player's preferences, before they join an arena
+func (db *Database) loadPrefs(p *Player) error {
+	return db.View(func(tx *bolt.Tx) error {
+		ps := tx.Bucket(playerBucket)
+		if ps == nil {
+			return nil
+		}
+		val := ps.Get([]byte(p.hash))
+		if val == nil {
+			return nil
+		}
+		tmp := Player{}
+		if err := json.Unmarshal(val, &tmp); err != nil {
+			return err
+		}
+		if knownColour(tmp.Colour) {
+			p.Colour = tmp.Colour
+		}
+		p.Invert = tmp.Invert
+		return nil
+	})
+}
+
+// savePrefs saves the player's preferences, leaving their
+// scores, new players are created with no scores
+func (db *Database) savePrefs(hash string, pr prefs) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		ps, err := tx.CreateBucketIfNotExists(playerBucket)
+		if err != nil {
+			return err
+		}
+		tmp := Player{SSHName: pr.sshName, Name: pr.name}
+		if val := ps.Get([]byte(hash)); val != nil {
+			if err := json.Unmarshal(val, &tmp); err != nil {
+				return err
+			}
+		} else if pr.name == "" {
+			return nil
+		}
+		tmp.Colour, tmp.Invert = pr.colour, pr.invert
+		val, err := json.Marshal(&tmp)
+		if err != nil {
+			return err
+		}
+		return ps.Put([]byte(hash), val)
+	})
+}
+
 func (db *Database) loadAll() ([]*Player, error) {
 	players := []*Player{}
 	err := db.View(func(tx *bolt.Tx) error {
@@ -0,0 +1,377 @@
+package tron
+
+import (
+	"math"
+	"math/rand"
+)
+
+const (
+	respawnAttempts  = 100
+	respawnLookahead = 15
+)
+
+// boost energy, riders regain one energy each tick they don't boost
+const (
+	energyMax = 60
+	boostCost = 3 // energy used each tick of boosting
+)
+
+// engine moves light cycles around a board. It has no connections,
+// clock or global randomness, so given the same seed and the same
+// directions, a game always plays out the same way.
+type engine struct {
+	w, h  int
+	board Board
+	rand  *rand.Rand
+	items int        // power-ups on the board
+	rec   *recording // nil unless recording
+	// set by the map
+	wrap   bool    // edges lead to the opposite edge
+	spawns []spawn // used instead of random places
+}
+
+// rider is a light cycle, moved by the engine
+type rider struct {
+	id    ID        // identification
+	x, y  int       // position
+	d     Direction // curr direction
+	nextd Direction // next direction
+	dead  bool
+	trail int   // current trail length
+	team  *team // nil unless playing in teams
+	// power-ups
+	fast, ghost int // ticks left
+	shield      bool
+	// boosting moves two tiles per tick, using energy
+	boost  bool
+	energy int
+	// randomness for the rider's strategy, seeded by the engine
+	// on its first snapshot
+	rand *rand.Rand
+}
+
+// crash is a rider which hit something during a step, the
+// killer is nil unless it hit another (unfriendly) rider's trail
+type crash struct {
+	victim, killer *rider
+}
+
+// newEngine returns an engine with an empty, walled board
+func newEngine(width, height int, seed int64) (*engine, error) {
+	board, err := NewBoard(width, height)
+	if err != nil {
+		return nil, err
+	}
+	e := &engine{
+		w:     width,
+		h:     height,
+		board: board,
+		rand:  rand.New(rand.NewSource(seed)),
+	}
+	// build walls
+	for w := 0; w < e.w; w++ {
+		e.board[w][0] = wall
+		e.board[w][e.h-1] = wall
+	}
+	for h := 0; h < e.h; h++ {
+		e.board[0][h] = wall
+		e.board[e.w-1][h] = wall
+	}
+	return e, nil
+}
+
+// step moves each living rider one square, in order, and returns
+// the crashes. riders should include the dead, whose trails may
+// still be on the board. fast or boosting riders move a second
+// square once everyone has moved.
+func (e *engine) step(riders []*rider) []crash {
+	e.rec.step(riders)
+	crashes := []crash{}
+	moves := make([]int, len(riders))
+	for i, r := range riders {
+		if !r.dead {
+			r.d = r.nextd
+			moves[i] = r.moves()
+		}
+	}
+	for sub := 1; sub <= 2; sub++ {
+		for i, r := range riders {
+			if r.dead || moves[i] < sub {
+				continue
+			}
+			c, moved := e.advance(r, riders)
+			if c != nil {
+				crashes = append(crashes, *c)
+			}
+			if !moved {
+				moves[i] = 0
+			}
+		}
+	}
+	for _, r := range riders {
+		if r.ghost > 0 {
+			r.ghost--
+		}
+	}
+	return crashes
+}
+
+// moves is the number of squares the rider moves this tick,
+// using up its speed power-up or boost energy
+func (r *rider) moves() int {
+	if r.fast > 0 {
+		r.fast--
+		return 2
+	}
+	if r.boost && r.energy >= boostCost {
+		r.energy -= boostCost
+		return 2
+	}
+	// not boosting, or out of energy
+	r.boost = false
+	if r.energy < energyMax {
+		r.energy++
+	}
+	return 1
+}
+
+// advance moves the rider one tile in its direction, reporting
+// whether it moved, and the crash if it hit something
+func (e *engine) advance(r *rider, riders []*rider) (*crash, bool) {
+	x, y := r.x, r.y
+	// move rider in [d]irection
+	r.x, r.y = e.ahead(x, y, r.d)
+	id := e.board[r.x][r.y]
+	if isItem(id) {
+		e.collect(r, id)
+		id = blank
+	}
+	// rider is in a wall, ghosts only crash into the edges
+	if id != blank && (r.ghost == 0 || id == wall) {
+		// shields stop the rider short, once
+		if r.shield {
+			r.shield = false
+			r.x, r.y = x, y
+			return nil, false
+		}
+		c := &crash{victim: r}
+		// is it another rider's wall? kills++
+		for _, other := range riders {
+			if other.id == id && other != r && !allies(other, r) {
+				c.killer = other
+			}
+		}
+		r.dead = true
+		return c, false
+	}
+	// place a rider square
+	e.board[r.x][r.y] = r.id
+	r.trail++
+	return nil, true
+}
+
+// allies reports whether a and b are on the same team
+func allies(a, b *rider) bool {
+	return a.team != nil && a.team == b.team
+}
+
+// steer sets the rider's next direction, unless
+// it would turn back on itself
+func (r *rider) steer(d Direction) {
+	if l, rt := r.d.Turns(); d == r.d || d == l || d == rt {
+		r.nextd = d
+	}
+}
+
+// wrapEdges removes the border walls, so that cycles leaving
+// one edge of the board appear on the opposite edge
+func (e *engine) wrapEdges() {
+	e.wrap = true
+	for w := 0; w < e.w; w++ {
+		e.board[w][0] = blank
+		e.board[w][e.h-1] = blank
+	}
+	for h := 0; h < e.h; h++ {
+		e.board[0][h] = blank
+		e.board[e.w-1][h] = blank
+	}
+}
+
+// ahead returns the tile one move from (x, y) in direction d,
+// across the edge when the board wraps
+func (e *engine) ahead(x, y int, d Direction) (int, int) {
+	ax, ay := Ahead(x, y, d)
+	if e.wrap {
+		ax = (ax + e.w) % e.w
+		ay = (ay + e.h) % e.h
+	}
+	return ax, ay
+}
+
+// open reports whether a cycle at s would have clear space ahead
+func (e *engine) open(s spawn) bool {
+	x, y := s.x, s.y
+	if x < 0 || y < 0 || x >= e.w || y >= e.h || e.board[x][y] != blank {
+		return false
+	}
+	for j := 0; j < respawnLookahead; j++ {
+		x, y = e.ahead(x, y, s.d)
+		if e.board[x][y] != blank {
+			return false
+		}
+	}
+	return true
+}
+
+// place puts the rider on one of the map's spawn points, otherwise
+// somewhere random, with clear space ahead. it reports whether a
+// place was found.
+func (e *engine) place(r *rider) bool {
+	for _, i := range e.rand.Perm(len(e.spawns)) {
+		if s := e.spawns[i]; e.open(s) {
+			e.spawn(r, s)
+			return true
+		}
+	}
+	for i := 0; i < respawnAttempts; i++ {
+		// randomly spawn rider
+		s := spawn{
+			x: e.rand.Intn(e.w-2) + 1,
+			y: e.rand.Intn(e.h-2) + 1,
+			d: directions[e.rand.Intn(len(directions))],
+		}
+		if e.open(s) {
+			e.spawn(r, s)
+			return true
+		}
+	}
+	return false
+}
+
+// spawn is a position and direction for a new cycle
+type spawn struct {
+	x, y int
+	d    Direction
+}
+
+// spawn places the rider at s, alive
+func (r *rider) spawn(s spawn) {
+	r.x, r.y = s.x, s.y
+	r.d = s.d
+	r.nextd = s.d
+	r.dead = false
+	r.trail = 0
+	r.fast, r.ghost, r.shield = 0, 0, false
+	r.boost, r.energy = false, energyMax
+}
+
+// spawn places the rider at s, for the recording
+func (e *engine) spawn(r *rider, s spawn) {
+	r.spawn(s)
+	e.rec.add(event{Kind: eventSpawn, ID: r.id, X: s.x, Y: s.y, D: s.d})
+}
+
+// spawnPoints spreads n cycles over the map's spawn points, otherwise
+// evenly around an ellipse in the middle of the board, each heading
+// around the ellipse. points without clear space ahead move
+// somewhere random.
+func (e *engine) spawnPoints(n int) []spawn {
+	spawns := make([]spawn, n)
+	if n > 0 && n <= len(e.spawns) {
+		for i := range spawns {
+			spawns[i] = e.clearSpawn(e.spawns[i*len(e.spawns)/n])
+		}
+		return spawns
+	}
+	cx, cy := float64(e.w)/2, float64(e.h)/2
+	rx, ry := cx*0.6, cy*0.6
+	for i := range spawns {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		dx, dy := -math.Sin(a), math.Cos(a)
+		s := spawn{
+			x: int(cx + rx*math.Cos(a)),
+			y: int(cy + ry*math.Sin(a)),
+		}
+		if math.Abs(dx) > math.Abs(dy) {
+			if dx < 0 {
+				s.d = dleft
+			} else {
+				s.d = dright
+			}
+		} else if dy < 0 {
+			s.d = dup
+		} else {
+			s.d = ddown
+		}
+		spawns[i] = e.clearSpawn(s)
+	}
+	return spawns
+}
+
+// clearSpawn moves s somewhere random, keeping its direction,
+// until it has clear space ahead
+func (e *engine) clearSpawn(s spawn) spawn {
+	for j := 0; j < respawnAttempts && !e.open(s); j++ {
+		s.x = e.rand.Intn(e.w-2) + 1
+		s.y = e.rand.Intn(e.h-2) + 1
+	}
+	return s
+}
+
+// clear removes the rider's trail from the board
+func (e *engine) clear(id ID) {
+	e.rec.add(event{Kind: eventClear, ID: id})
+	for w := 0; w < e.w; w++ {
+		for h := 0; h < e.h; h++ {
+			if e.board[w][h] == id {
+				e.board[w][h] = blank
+			}
+		}
+	}
+}
+
+// reset removes all trails, leaving the walls
+func (e *engine) reset() {
+	e.rec.add(event{Kind: eventReset})
+	e.items = 0
+	for w := 0; w < e.w; w++ {
+		for h := 0; h < e.h; h++ {
+			if e.board[w][h] != wall {
+				e.board[w][h] = blank
+			}
+		}
+	}
+}
+
+// snapshot is the board and riders, as seen by the given rider
+func (e *engine) snapshot(self *rider, riders []*rider) *Snapshot {
+	if self.rand == nil {
+		self.rand = rand.New(rand.NewSource(e.rand.Int63()))
+	}
+	s := &Snapshot{
+		Width:  e.w,
+		Height: e.h,
+		Wrap:   e.wrap,
+		Self:   self.cycle(self),
+		Rand:   self.rand,
+		board:  e.board,
+	}
+	for _, r := range riders {
+		if r != self {
+			s.Opponents = append(s.Opponents, r.cycle(self))
+		}
+	}
+	return s
+}
+
+// cycle is the rider, as seen by the given rider
+func (r *rider) cycle(by *rider) Cycle {
+	return Cycle{
+		ID:        r.id,
+		X:         r.x,
+		Y:         r.y,
+		Direction: r.d,
+		Alive:     !r.dead,
+		Teammate:  r != by && allies(r, by),
+	}
+}
@@ -0,0 +1,167 @@
+package tron
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAdvance(t *testing.T) {
+	red := &team{name: "red"}
+	type want struct {
+		x, y   int
+		dead   bool
+		killer ID
+	}
+	tests := []struct {
+		name   string
+		wrap   bool
+		riders []rider
+		trails map[point]ID
+		want   []want
+	}{
+		{
+			name:   "blank tile",
+			riders: []rider{{id: 1, x: 5, y: 5, d: dright}},
+			want:   []want{{x: 6, y: 5}},
+		},
+		{
+			name:   "border wall",
+			riders: []rider{{id: 1, x: 1, y: 5, d: dleft}},
+			want:   []want{{x: 0, y: 5, dead: true}},
+		},
+		{
+			name:   "wrap across the edge",
+			wrap:   true,
+			riders: []rider{{id: 1, x: 0, y: 5, d: dleft}},
+			want:   []want{{x: 15, y: 5}},
+		},
+		{
+			name:   "opponent's trail",
+			riders: []rider{{id: 1, x: 5, y: 5, d: dup}, {id: 2, x: 8, y: 8, d: dup}},
+			trails: map[point]ID{{5, 4}: 2},
+			want:   []want{{x: 5, y: 4, dead: true, killer: 2}, {x: 8, y: 7}},
+		},
+		{
+			name:   "own trail",
+			riders: []rider{{id: 1, x: 5, y: 5, d: dup}},
+			trails: map[point]ID{{5, 4}: 1},
+			want:   []want{{x: 5, y: 4, dead: true}},
+		},
+		{
+			name:   "head-on",
+			riders: []rider{{id: 1, x: 5, y: 5, d: dright}, {id: 2, x: 6, y: 5, d: dleft}},
+			want:   []want{{x: 6, y: 5, dead: true, killer: 2}, {x: 5, y: 5, dead: true, killer: 1}},
+		},
+		{
+			name:   "head-on across a gap",
+			riders: []rider{{id: 1, x: 4, y: 5, d: dright}, {id: 2, x: 6, y: 5, d: dleft}},
+			want:   []want{{x: 5, y: 5}, {x: 5, y: 5, dead: true, killer: 1}},
+		},
+		{
+			name:   "ally's trail crashes without a kill",
+			riders: []rider{{id: 1, x: 5, y: 5, d: dup, team: red}, {id: 2, x: 8, y: 8, d: dup, team: red}},
+			trails: map[point]ID{{5, 4}: 2},
+			want:   []want{{x: 5, y: 4, dead: true}, {x: 8, y: 7}},
+		},
+		{
+			name:   "ghost passes through a trail",
+			riders: []rider{{id: 1, x: 5, y: 5, d: dup, ghost: 3}, {id: 2, x: 8, y: 8, d: dup}},
+			trails: map[point]ID{{5, 4}: 2},
+			want:   []want{{x: 5, y: 4}, {x: 8, y: 7}},
+		},
+		{
+			name:   "ghost hits the border",
+			riders: []rider{{id: 1, x: 1, y: 5, d: dleft, ghost: 3}},
+			want:   []want{{x: 0, y: 5, dead: true}},
+		},
+		{
+			name:   "shield stops short",
+			riders: []rider{{id: 1, x: 5, y: 5, d: dup, shield: true}, {id: 2, x: 8, y: 8, d: dup}},
+			trails: map[point]ID{{5, 4}: 2},
+			want:   []want{{x: 5, y: 5}, {x: 8, y: 7}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newEngine(16, 16, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wrap {
+				e.wrapEdges()
+			}
+			riders := make([]*rider, len(tt.riders))
+			for i := range tt.riders {
+				r := tt.riders[i]
+				riders[i] = &r
+				e.board[r.x][r.y] = r.id
+			}
+			for p, id := range tt.trails {
+				e.board[p.x][p.y] = id
+			}
+			killers := map[ID]ID{}
+			for _, r := range riders {
+				if r.dead {
+					continue
+				}
+				if c, _ := e.advance(r, riders); c != nil && c.killer != nil {
+					killers[r.id] = c.killer.id
+				}
+			}
+			for i, r := range riders {
+				w := tt.want[i]
+				if r.x != w.x || r.y != w.y || r.dead != w.dead || killers[r.id] != w.killer {
+					t.Errorf("rider %d at (%d,%d) dead %v killed by %d, want (%d,%d) dead %v killed by %d",
+						r.id, r.x, r.y, r.dead, killers[r.id], w.x, w.y, w.dead, w.killer)
+				}
+			}
+		})
+	}
+}
+
+// TestDeterminism plays bots with every strategy, power-ups and
+// respawns twice from the same seed, which must end the same way
+func TestDeterminism(t *testing.T) {
+	play := func() (Board, []rider) {
+		e, err := newEngine(48, 32, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{strategyFloodFill, strategyWallFollow, strategyRandom, strategyRandom, strategyFloodFill}
+		riders := make([]*rider, len(names))
+		strategies := make([]Strategy, len(names))
+		for i, name := range names {
+			riders[i] = &rider{id: ID(i + 1)}
+			if strategies[i], err = newStrategy(name); err != nil {
+				t.Fatal(err)
+			}
+			e.place(riders[i])
+		}
+		for tick := 0; tick < 2000; tick++ {
+			e.drop()
+			for i, r := range riders {
+				if r.dead {
+					e.clear(r.id)
+					e.place(r)
+					continue
+				}
+				r.steer(strategies[i].Steer(e.snapshot(r, riders)))
+			}
+			e.step(riders)
+		}
+		states := make([]rider, len(riders))
+		for i, r := range riders {
+			states[i] = *r
+			states[i].rand = nil
+		}
+		return e.board, states
+	}
+	b1, r1 := play()
+	b2, r2 := play()
+	if !reflect.DeepEqual(r1, r2) {
+		t.Fatalf("riders differ:\n%+v\n%+v", r1, r2)
+	}
+	if !reflect.DeepEqual(b1, b2) {
+		t.Fatal("boards differ")
+	}
+}
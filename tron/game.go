@@ -4,70 +4,190 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
-	"os/signal"
+	"sync"
 	"time"
 )
 
 type ID uint16
 
+// most players in a game, ids above it are used for power-ups,
+// walls and the screen's reset colour
+const maxPlayers = 100
+
+// Game is a single arena, with its own board, players and game loop
 type Game struct {
 	Config
-	w, h, bw, bh     int         // total score+board size
+	name             string      // arena name
+	lobby            *Lobby      // owner of all arenas
+	bw, bh           int         // board size
 	db               *Database   // database
-	server           *Server     // ssh server
 	score            *scoreboard // state
 	bot              *Bot        // chat bot
-	board            Board
+	engine           *engine     // moves the cycles
+	rec              *recording  // nil unless recording replays
+	history          *history    // recent boards, nil unless kill-cams are on
+	minimap          *minimap    // shrunk board, nil unless someone needs it
+	board            Board       // the engine's board
 	idPool           chan ID
 	allPlayers       map[string]*Player
 	allPlayersSorted []*Player
 	currPlayers      map[ID]*Player
+	spectators       map[*Player]bool
+	queue            []*Player        // waiting for an id
+	departures       []time.Time      // recent id returns
+	round            int              // current round number
+	roundEnd         time.Time        // end of the last round, zero while playing
+	winner           *Player          // winner of the last round
+	winnerTeam       *team            // winning team of the last round
+	teams            []*team          // nil unless playing in teams
+	result           *roundResult     // result of the last round
+	warmup           bool             // elimination round with too few players
+	frozen           time.Time        // reset after any death, zero while playing
+	thawed           bool             // trails wiped while frozen
+	banner           []string         // drawn over the board between rounds
+	emptied          time.Time        // when the last person left, zero while anyone is here
+	joins, leaves    chan *Player     // player events
+	inputs           chan inputEvent  // key press events
+	resizes          chan resizeEvent // terminal resize events
+	quit, done       chan struct{}    // shutdown the game loop
+	info             arenaInfo        // published for the lobby
+	infoMut          sync.Mutex
 	logf             func(format string, args ...interface{})
 }
 
-// NewGame returns an initialized Game according to the input arguments.
-// The main() function should call the Play() method on this Game.
-func NewGame(c Config) (*Game, error) {
-	if c.Height < 32 || c.Height > 255 {
-		return nil, errors.New("height must be between 32-256")
+// arenaInfo is a snapshot of the arena, read by the lobby
+type arenaInfo struct {
+	players, queued, spectators int
+}
+
+// inputEvent is a chunk of bytes sent by a player
+type inputEvent struct {
+	p *Player
+	b []byte
+}
+
+// resizeEvent is a change to a player's terminal size
+type resizeEvent struct {
+	p *Player
+	r resize
+}
+
+// validate checks and normalises an arena's config
+func validate(c *Config) error {
+	// maps from files set the board size
+	if c.Map != "" {
+		m, err := loadMap(c.Map, c.Width, c.Height)
+		if err != nil {
+			return fmt.Errorf("map %s: %s", c.Map, err)
+		}
+		c.Width, c.Height = m.w, m.h
 	}
-	if c.Width < 32 || c.Width > 255 {
-		return nil, errors.New("width must be between 32-256")
+	if c.Height < minBoardSize || c.Height > maxBoardSize {
+		return fmt.Errorf("height must be between %d-%d", minBoardSize, maxBoardSize)
 	}
-	db, err := NewDatabase(c.DBLocation, c.DBReset)
-	if err != nil {
+	if c.Width < minBoardSize || c.Width > maxBoardSize {
+		return fmt.Errorf("width must be between %d-%d", minBoardSize, maxBoardSize)
+	}
+	if c.GameSpeed <= 0 {
+		return errors.New("game speed must be positive")
+	}
+	if c.MaxPlayers < 1 || c.MaxPlayers > maxPlayers {
+		return fmt.Errorf("max players must be between 1-%d", maxPlayers)
+	}
+	switch c.Mode {
+	case "":
+		c.Mode = modeKills
+	case modeKills, modeElimination, modeTrail:
+	default:
+		return fmt.Errorf("unknown mode: %s", c.Mode)
+	}
+	if c.Teams != 0 && (c.Teams < 2 || c.Teams > len(namedColours)) {
+		return fmt.Errorf("teams must be between 2-%d", len(namedColours))
+	}
+	if c.ResetOnDeath && c.Mode == modeElimination {
+		return errors.New("reset on death cannot be used in elimination mode")
+	}
+	if c.Bots < 0 || c.Bots > c.MaxPlayers {
+		return errors.New("bots must be between 0 and max players")
+	}
+	if c.BotStrategy == "" {
+		c.BotStrategy = strategyFloodFill
+	}
+	if _, err := newStrategy(c.BotStrategy); err != nil {
+		return err
+	}
+	if c.BotPrograms != "" && c.BotTimeout <= 0 {
+		return errors.New("bot timeout must be positive")
+	}
+	return nil
+}
+
+// newGame returns an initialized arena according to the input arguments.
+// The lobby should call the start() method on this Game.
+func newGame(name string, c Config, l *Lobby) (*Game, error) {
+	if err := validate(&c); err != nil {
 		return nil, err
 	}
-	board, err := NewBoard(uint8(c.Width), uint8(c.Height))
+	e, err := newEngine(c.Width, c.Height, rand.Int63())
 	if err != nil {
 		return nil, err
 	}
+	if c.Map != "" {
+		m, err := loadMap(c.Map, c.Width, c.Height)
+		if err != nil {
+			return nil, err
+		}
+		e.load(m)
+	}
+	if c.Wrap {
+		e.wrapEdges()
+	}
 	// create an id pool
 	idPool := make(chan ID, c.MaxPlayers)
 	for id := 1; id <= c.MaxPlayers; id++ {
 		idPool <- ID(id)
 	}
-	server, err := NewServer(db, c.Port, idPool)
-	if err != nil {
-		return nil, err
+	prefix := "tron: "
+	if name != defaultArena {
+		prefix = "tron/" + name + ": "
 	}
 	g := &Game{
 		Config:      c,
-		w:           c.Width + sidebarWidth,
-		h:           c.Height / 2,
-		bw:          c.Height,
-		bh:          c.Width,
-		db:          db,
-		server:      server,
-		bot:         &Bot{},
-		board:       board,
+		name:        name,
+		lobby:       l,
+		bw:          c.Width,
+		bh:          c.Height,
+		db:          l.db,
+		bot:         l.bot,
+		engine:      e,
+		board:       e.board,
 		idPool:      idPool,
 		allPlayers:  make(map[string]*Player),
 		currPlayers: make(map[ID]*Player),
-		logf:        log.New(os.Stdout, "tron: ", 0).Printf,
+		spectators:  make(map[*Player]bool),
+		round:       1,
+		warmup:      c.Mode == modeElimination,
+		joins:       make(chan *Player),
+		leaves:      make(chan *Player),
+		inputs:      make(chan inputEvent),
+		resizes:     make(chan resizeEvent),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+		logf:        log.New(os.Stdout, prefix, 0).Printf,
 	}
 	g.score = &scoreboard{g: g}
+	if c.KillCam {
+		frames := int(killcamLength / c.GameSpeed)
+		if frames < 1 {
+			frames = 1
+		}
+		g.history = newHistory(c.Width, c.Height, frames)
+	}
+	if c.Teams > 0 {
+		g.teams = newTeams(c.Teams)
+	}
 	//load initial player list
 	prevPlayers, err := g.db.loadAll()
 	if err != nil {
@@ -76,194 +196,432 @@ func NewGame(c Config) (*Game, error) {
 	for _, p := range prevPlayers {
 		g.allPlayers[p.hash] = p
 	}
-	// initialise slack if provided
-	if t := c.SlackToken; t != "" {
-		ch := c.SlackChannel
-		if ch == "" {
-			return nil, errors.New("Slack channel must also be specified (--slack-channel)")
-		}
-		if err := g.bot.init(t, ch); err != nil {
-			return nil, err
-		}
-		motd := "tron server started\n"
-		if g.Config.JoinAddress != "" {
-			motd += fmt.Sprintf("join using: `ssh %s`", g.Config.JoinAddress)
-		} else {
-			motd += fmt.Sprintf("join using:\n```\n%s\n```\n", g.server.addresses)
-		}
-		if err := g.bot.message(motd); err != nil {
-			return nil, err
-		}
-		go g.bot.start()
-	}
 	//compute initial score, load into slackbot
 	g.score.compute()
+	g.publish()
 	//game ready
 	return g, nil
 }
 
-func (g *Game) Play() {
-	// build walls
-	for w := 0; w < g.bw; w++ {
-		g.board[w][0] = wall
-		g.board[w][g.bh-1] = wall
-	}
-	for h := 0; h < g.bh; h++ {
-		g.board[0][h] = wall
-		g.board[g.bw-1][h] = wall
-	}
+func (g *Game) start() {
+	g.startPrograms()
+	g.startRecording()
+	// start the game loop! it owns all game state from here on
+	go g.loop()
+	// ready for players!
+	g.logf("game started (#%d player slots, %s/tick, %s mode)", len(g.idPool), g.GameSpeed, g.Mode)
+}
 
-	// start the game ticker!
-	go g.tick()
+// loop is the only goroutine which may touch the board,
+// the player maps and the game-related player fields.
+// everything else must send it an event.
+func (g *Game) loop() {
+	ticker := time.NewTicker(g.GameSpeed)
+	defer ticker.Stop()
+	for {
+		select {
+		case p := <-g.joins:
+			g.join(p)
+		case p := <-g.leaves:
+			g.leave(p)
+		case e := <-g.inputs:
+			if g.connected(e.p) {
+				e.p.action(e.b)
+			}
+		case e := <-g.resizes:
+			if g.connected(e.p) {
+				e.p.setSize(e.r)
+			}
+		case <-ticker.C:
+			g.tick()
+			if g.idle() {
+				g.logf("closing empty arena")
+				g.lobby.remove(g)
+				g.shutdown()
+				return
+			}
+		case <-g.quit:
+			g.shutdown()
+			return
+		}
+	}
+}
 
-	// ready for players!
-	g.logf("game started (#%d player slots, %s/tick)", len(g.idPool), g.Config.GameSpeed)
-
-	// watch signals (catch Ctrl+C and gracefully shutdown)
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
-	go g.watch(c)
-	addr := g.Config.JoinAddress
-	if addr == "" {
-		addr = "\n" + g.server.addresses
-	}
-	// start the ssh server
-	go g.server.start()
-	g.logf("server up (fingerprint %s)\njoin at: %s\n", fingerprintKey(g.server.privateKey.PublicKey()), addr)
-	// handle incoming players forever (channel never closed)
-	for p := range g.server.newPlayers {
-		go g.handle(p)
+// idle reports whether this created arena has had no players,
+// other than bots, no queue and no spectators for arenaIdle
+func (g *Game) idle() bool {
+	if g.name == defaultArena {
+		return false
 	}
+	empty := len(g.spectators) == 0 && len(g.queue) == 0
+	for _, p := range g.currPlayers {
+		empty = empty && p.ai != nil
+	}
+	if !empty {
+		g.emptied = time.Time{}
+		return false
+	}
+	if g.emptied.IsZero() {
+		g.emptied = time.Now()
+	}
+	return time.Since(g.emptied) >= arenaIdle
 }
 
-func (g *Game) watch(c chan os.Signal) {
-	<-c
+func (g *Game) shutdown() {
 	g.logf("game ending...")
+	g.stopRecording()
 	for _, p := range g.currPlayers {
 		p.teardown()
 	}
-	g.db.Close()
-	time.Sleep(300 * time.Millisecond)
-	os.Exit(0)
+	for p := range g.spectators {
+		p.teardown()
+	}
+	for _, p := range g.queue {
+		p.teardown()
+	}
+	close(g.done)
+}
+
+// stop shuts down the game loop, disconnecting everyone
+func (g *Game) stop() {
+	close(g.quit)
+	<-g.done
+}
+
+// botScores reports whether this arena sends score changes to the
+// chat bot, only the default arena does so there is one leaderboard
+func (g *Game) botScores() bool {
+	return g.bot.connected && g.name == defaultArena
+}
+
+// announce sends a message to the chat bot, when connected
+func (g *Game) announce(msg string) {
+	if !g.bot.connected {
+		return
+	}
+	if g.name != defaultArena {
+		msg = "[" + g.name + "] " + msg
+	}
+	go g.bot.message(msg)
 }
 
+// handle prepares a new connection, then hands it over to the game loop
 func (g *Game) handle(p *Player) {
+	p.g = g
+	if !p.spectating {
+		// attempt to load previous scores
+		if err := g.db.load(p); err != nil {
+			//otherwise new player
+			g.db.save(p)
+		}
+	}
+	// empty arenas close, so this one may have just gone
+	select {
+	case g.joins <- p:
+	case <-g.done:
+		g.lobby.release(p)
+		p.farewell = fmt.Sprintf("Arena %s has closed\r\n", g.name)
+		p.teardown()
+	}
+}
+
+// playing reports whether p is currently in the game
+func (g *Game) playing(p *Player) bool {
+	return p.id != blank && g.currPlayers[p.id] == p
+}
+
+// connected reports whether p is currently playing, spectating or queued
+func (g *Game) connected(p *Player) bool {
+	return g.playing(p) || g.spectators[p] || p.queued
+}
+
+func (g *Game) join(p *Player) {
+	if p.spectating {
+		g.spectators[p] = true
+		p.play()
+		g.publish()
+		return
+	}
 	// check not already connected
 	if existing, ok := g.allPlayers[p.hash]; ok && existing.id != blank {
 		p.teardown()
 		p.logf("rejected - already connected as %s", existing.cname)
-		g.idPool <- p.id //put back
+		return
+	} else if g.inQueue(p.hash) {
+		p.teardown()
+		p.logf("rejected - already queued")
 		return
 	}
-	// attempt to load previous scores
-	if err := g.db.load(p); err != nil {
-		//otherwise new player
-		g.db.save(p)
+	// humans take priority over bots
+	if len(g.idPool) == 0 {
+		g.removeBot()
 	}
-	// connected with a valid id
-	p.g = g
+	// non-blocking pull off the id pool, otherwise wait in the queue
+	select {
+	case id := <-g.idPool:
+		g.admit(p, id)
+	default:
+		g.enqueue(p)
+	}
+	p.play()
+	g.publish()
+}
+
+// publish updates the lobby's snapshot of this arena
+func (g *Game) publish() {
+	g.infoMut.Lock()
+	g.info = arenaInfo{
+		players:    len(g.currPlayers),
+		queued:     len(g.queue),
+		spectators: len(g.spectators),
+	}
+	g.infoMut.Unlock()
+}
+
+// snapshot returns the last published arena info
+func (g *Game) snapshot() arenaInfo {
+	g.infoMut.Lock()
+	defer g.infoMut.Unlock()
+	return g.info
+}
+
+// admit places a player into the game with a valid id
+func (g *Game) admit(p *Player, id ID) {
+	p.setID(id)
 	g.allPlayers[p.hash] = p
 	g.currPlayers[p.id] = p
+	g.assignTeam(p)
+	g.pickColour(p)
+	g.rec.add(event{Kind: eventJoin, ID: id, Name: p.Name, Colour: g.colourName(id)})
 	g.score.compute()
-	// connected
-	p.play() //block while playing
-	// disconnected
-	g.remove(p)
+}
+
+func (g *Game) leave(p *Player) {
+	if g.spectators[p] {
+		p.logf("stopped spectating")
+		delete(g.spectators, p)
+		p.teardown()
+		g.publish()
+		return
+	}
+	if g.dequeue(p) {
+		p.logf("left the queue")
+		p.teardown()
+		g.lobby.release(p)
+		g.publish()
+		return
+	}
+	if !g.playing(p) {
+		return //already gone
+	}
+	p.logf("disconnected")
+	g.engine.clear(p.id)
 	delete(g.currPlayers, p.id)
+	g.rec.add(event{Kind: eventLeave, ID: p.id})
 	// reinsert back into pool
 	g.idPool <- p.id
 	p.id = blank
 	p.teardown()
+	g.lobby.release(p)
+	// forget bots without saved scores
+	if p.ai != nil && !g.BotStats {
+		delete(g.allPlayers, p.hash)
+		g.score.compute()
+	}
+	// next in line
+	g.departed()
+	g.promote()
+	g.publish()
+}
+
+// save stores the player's scores, bots are only saved when configured
+func (g *Game) save(p *Player) {
+	if p.ai != nil && !g.BotStats {
+		return
+	}
+	g.db.saveAsync(p)
 }
 
+// kick removes a player from the game with a farewell message
+func (g *Game) kick(p *Player, reason string) {
+	p.logf("kicked (%s)", reason)
+	p.farewell = fmt.Sprintf("You were kicked from tron: %s\r\n", reason)
+	g.announce(fmt.Sprintf("*%s* was kicked (%s)", p.SSHName, reason))
+	g.leave(p)
+}
+
+//number of moves a player must survive to reset their death streak
+var streakSurvival = 100
+
 func (g *Game) death(p *Player) {
+	p.dead = true
 	p.Deaths++
+	p.deathStreak++
+	g.scoreTrail(p)
 	g.score.compute()
-	go g.db.save(p) //save new death count
+	g.save(p) //save new death count
 	p.tdeath = time.Now()
-	g.remove(p)
+	p.waiting = true
+	p.cleared = false
+}
+
+// punish kicks bad players, once all of a step's crashes are
+// scored, so that kicked players are still credited with kills
+func (g *Game) punish(p *Player) {
+	if g.KickDeaths > 0 && p.ai == nil && p.deathStreak >= g.KickDeaths {
+		g.kick(p, fmt.Sprintf("%d deaths in a row", p.deathStreak))
+	}
+}
+
+// scoreTrail scores the trail the player leaves behind
+func (g *Game) scoreTrail(p *Player) {
+	p.Points += p.trail
+	if p.team != nil {
+		p.team.points += p.trail
+	}
+	if p.trail > p.Best {
+		p.Best = p.trail
+		if g.Mode == modeTrail {
+			p.logf("new best trail %d", p.Best)
+		}
+	}
 }
 
 //time to keep players trail around after death
 var deathTrail = 1 * time.Second
 
-func (g *Game) remove(p *Player) {
-	p.waiting = true
-	//respawn/deathtrail time
-	if g.RespawnDelay > deathTrail {
-		time.Sleep(deathTrail)
+// wait progresses a dead player through its death trail and respawn delay
+func (g *Game) wait(p *Player) {
+	dead := time.Since(p.tdeath)
+	p.killcam.next()
+	// clear this player off the board!
+	if !p.cleared && (dead >= deathTrail || dead >= g.RespawnDelay) {
+		g.engine.clear(p.id)
+		p.cleared = true
+	}
+	if dead >= g.RespawnDelay {
+		p.waiting = false
+		p.killcam = nil
+	}
+}
+
+func (g *Game) tick() {
+	g.recordTick()
+	if g.intermission() {
+		if time.Since(g.roundEnd) >= roundDelay {
+			g.startRound()
+		}
+	} else if g.freezing() {
+		g.thaw()
 	} else {
-		time.Sleep(g.RespawnDelay)
+		if g.PowerUps {
+			g.engine.drop()
+		}
+		g.steerBots()
+		deaths := g.move()
+		g.checkRound()
+		if deaths > 0 && g.ResetOnDeath && !g.intermission() {
+			g.freeze()
+		}
 	}
-	// clear this player off the board!
-	for w := 0; w < g.bw; w++ {
-		for h := 0; h < g.bh; h++ {
-			if g.board[w][h] == p.id {
-				g.board[w][h] = blank
-			}
+	g.fillBots()
+	g.renderBanner()
+	g.renderQueue()
+	// update bot score list
+	if g.score.changed && g.botScores() {
+		g.bot.scoreChange(g.score.allPlayersSorted)
+	}
+	g.renderMinimap()
+	// send delta updates to each player
+	for _, p := range g.currPlayers {
+		if p.ready {
+			p.update()
 		}
 	}
-	//respawn extra
-	if g.RespawnDelay > deathTrail {
-		time.Sleep(g.RespawnDelay - deathTrail)
+	for p := range g.spectators {
+		if p.ready {
+			p.update()
+		}
 	}
-	p.waiting = false
+	for _, p := range g.queue {
+		if p.ready {
+			p.update()
+		}
+	}
+	// mark score as used
+	g.score.changed = false
 }
 
-func (g *Game) tick() {
-	// loop forever
-	for {
-		t0 := time.Now()
-		// move each player 1 square
-		for _, p := range g.currPlayers {
-			// skip this player
-			if p.dead {
-				continue
-			}
-			// move player in [d]irection
-			p.d = p.nextd
-			switch p.d {
-			case dup:
-				p.y--
-			case ddown:
-				p.y++
-			case dleft:
-				p.x--
-			case dright:
-				p.x++
-			}
-			// player is in a wall
-			if g.board[p.x][p.y] != blank {
-				// is it another player's wall? kills++
-				id := g.board[p.x][p.y]
-				if other, ok := g.currPlayers[id]; ok && other != p {
-					other.Kills++
-					g.score.compute()
-					go g.db.save(other) //save new kill count
-					other.logf("killed %s", p.cname)
-				}
-				// this player dies...
-				p.dead = true
-				go g.death(p)
-				continue
-			}
-			// place a player square
-			g.board[p.x][p.y] = p.id
+// move steps the engine, then scores any crashes
+func (g *Game) move() (deaths int) {
+	for _, p := range g.currPlayers {
+		if p.dead && p.waiting {
+			g.wait(p)
+		}
+	}
+	riders := g.riders()
+	// trails before the step, fast riders move two tiles
+	trails := make([]int, len(riders))
+	for i, r := range riders {
+		trails[i] = r.trail
+	}
+	crashes := g.engine.step(riders)
+	if g.history != nil {
+		g.history.remember(g.board)
+	}
+	victims := []*Player{}
+	for _, c := range crashes {
+		p := g.currPlayers[c.victim.id]
+		e := event{Kind: eventDeath, ID: p.id}
+		var killer *Player
+		if c.killer != nil {
+			e.Killer = c.killer.id
+			killer = g.currPlayers[c.killer.id]
+			g.kill(killer, p)
 		}
-		// update bot score list
-		if g.score.changed && g.bot.connected {
-			g.bot.scoreChange(g.score.allPlayersSorted)
+		g.rec.add(e)
+		// this player dies...
+		g.death(p)
+		g.startKillcam(p, killer)
+		victims = append(victims, p)
+		deaths++
+	}
+	for i, r := range riders {
+		if !r.dead && trails[i] < streakSurvival && r.trail >= streakSurvival {
+			g.currPlayers[r.id].deathStreak = 0
 		}
-		// send delta updates to each player
-		for _, p := range g.currPlayers {
-			if p.ready {
-				p.update()
-			}
+	}
+	for _, p := range victims {
+		g.punish(p)
+	}
+	return deaths
+}
+
+// riders returns the players' cycles in id order, so
+// that the engine moves them in a repeatable order
+func (g *Game) riders() []*rider {
+	riders := []*rider{}
+	for id := ID(1); int(id) <= g.MaxPlayers; id++ {
+		if p, ok := g.currPlayers[id]; ok {
+			riders = append(riders, &p.rider)
+		}
+	}
+	return riders
+}
+
+func (g *Game) kill(killer, victim *Player) {
+	killer.Kills++
+	killer.roundKills++
+	killer.deathStreak = 0
+	g.score.compute()
+	g.save(killer) //save new kill count
+	killer.logf("killed %s", victim.cname)
+	if killer.team != nil {
+		killer.team.kills++
+		if t := g.teamWinner(); t != nil && g.winnerTeam == nil {
+			g.winnerTeam = t
 		}
-		// mark score as used
-		g.score.changed = false
-		// game sleep! (attempt to stablize game speed)
-		cpu := time.Now().Sub(t0)
-		time.Sleep(g.GameSpeed - cpu*2)
+	} else if g.KillLimit > 0 && killer.roundKills >= g.KillLimit && g.winner == nil {
+		g.winner = killer
 	}
 }
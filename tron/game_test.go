@@ -0,0 +1,159 @@
+package tron
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeChannel is an ssh channel whose input is written by the test,
+// and whose output is thrown away
+type fakeChannel struct {
+	r *io.PipeReader
+}
+
+func (c fakeChannel) Read(b []byte) (int, error)                     { return c.r.Read(b) }
+func (c fakeChannel) Write(b []byte) (int, error)                    { return len(b), nil }
+func (c fakeChannel) Close() error                                   { return c.r.Close() }
+func (c fakeChannel) CloseWrite() error                              { return nil }
+func (c fakeChannel) SendRequest(string, bool, []byte) (bool, error) { return false, nil }
+func (c fakeChannel) Stderr() io.ReadWriter                          { return nil }
+
+// keys pressed by the fake players: arrows, enter (respawn),
+// space (boost) and i (invert)
+var fakeKeys = [][]byte{
+	{27, 91, 65}, {27, 91, 66}, {27, 91, 67}, {27, 91, 68},
+	{13}, {13}, {' '}, {'i'},
+}
+
+// TestLoad drives the arenas' game loops with many players, who
+// join, press keys, resize, respawn, leave and come back, while
+// bots fill the gaps. run it with -race to check that only the
+// game loops touch the game state.
+func TestLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+	dir, err := ioutil.TempDir("", "tron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := NewLobby(Config{
+		Width:        48,
+		Height:       32,
+		MaxPlayers:   24,
+		GameSpeed:    10 * time.Millisecond,
+		RespawnDelay: 20 * time.Millisecond,
+		DBLocation:   filepath.Join(dir, "tron.db"),
+		Mode:         modeKills,
+		Bots:         6,
+		BotStrategy:  strategyRandom,
+		KillCam:      true,
+		PowerUps:     true,
+		Viewport:     true,
+		RecordDir:    filepath.Join(dir, "replays"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.arena(defaultArena).start()
+	if _, err := l.create([]string{"side", "--speed", "20ms", "--mode", modeTrail, "--width", "32", "--height", "32", "--bots", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	online := func(hash string) bool {
+		l.mut.Lock()
+		defer l.mut.Unlock()
+		_, ok := l.online[hash]
+		return ok
+	}
+	const players = 40
+	var wg sync.WaitGroup
+	for i := 0; i < players; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(i)))
+			// each player connects twice, the second time once
+			// the game loop has seen them leave
+			for visit := 0; visit < 2; visit++ {
+				command := "join"
+				switch {
+				case i%10 == 0:
+					command = cmdSpectate
+				case i%4 == 0:
+					command = "join side"
+				}
+				name := fmt.Sprintf("player%d", i)
+				for start := time.Now(); online(name); time.Sleep(time.Millisecond) {
+					if time.Since(start) > 5*time.Second {
+						t.Errorf("%s is still online after leaving", name)
+						return
+					}
+				}
+				pr, pw := io.Pipe()
+				p := NewPlayer(blank, name, name, name, fakeChannel{pr})
+				p.command = command
+				p.size = resize{uint32(40 + r.Intn(60)), uint32(10 + r.Intn(30))}
+				go l.route(p)
+				for j := 0; j < 100; j++ {
+					if _, err := pw.Write(fakeKeys[r.Intn(len(fakeKeys))]); err != nil {
+						// the connection was closed by the game
+						t.Errorf("%s was rejected on visit %d", name, visit+1)
+						break
+					}
+					if j%10 == 0 {
+						select {
+						case p.resizes <- resize{uint32(40 + r.Intn(60)), uint32(10 + r.Intn(30))}:
+						case <-time.After(10 * time.Millisecond):
+						}
+					}
+					time.Sleep(time.Millisecond)
+				}
+				pw.Close()
+				close(p.resizes)
+			}
+		}(i)
+	}
+	go func() {
+		for i := 0; i < 50; i++ {
+			l.list()
+			l.whoIsOnline()
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	wg.Wait()
+	// let the game loops see everyone leave, and bots fill in
+	time.Sleep(500 * time.Millisecond)
+	l.mut.Lock()
+	arenas := []*Game{}
+	for _, g := range l.arenas {
+		arenas = append(arenas, g)
+	}
+	if len(l.online) > 0 {
+		t.Errorf("%d players are still online", len(l.online))
+	}
+	l.mut.Unlock()
+	for _, g := range arenas {
+		// the game state is the test's once the loop has stopped
+		g.stop()
+		for _, p := range g.currPlayers {
+			if p.ai == nil {
+				t.Errorf("arena %s still has %s playing", g.name, p.Name)
+			}
+		}
+		if len(g.spectators) > 0 || len(g.queue) > 0 {
+			t.Errorf("arena %s still has %d spectators and %d queued", g.name, len(g.spectators), len(g.queue))
+		}
+		if n := len(g.idPool); n != g.MaxPlayers-g.Bots {
+			t.Errorf("arena %s has %d free ids, want %d", g.name, n, g.MaxPlayers-g.Bots)
+		}
+	}
+	l.db.Close()
+}
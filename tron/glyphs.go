@@ -0,0 +1,113 @@
+package tron
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// environment variable, sent over ssh, which chooses the glyph set
+const glyphsEnv = "TRON_GLYPHS"
+
+// glyphSet is how a player's terminal draws the board. half-block
+// sets stack two tiles in each rune, the others draw one tile in
+// each rune, or in two runes side by side.
+type glyphSet struct {
+	name                string
+	filled, top, bottom rune // both tiles, the top tile, the bottom tile
+	faded               rune // kill-cam trails which had nothing to do with the death
+	trail, window       rune // minimap trails, and the part of the board on screen
+	ascii               bool // power-ups drawn in plain ASCII
+	rows                int  // tiles stacked in each rune
+	cols                int  // runes across each tile
+}
+
+// glyphSets in the order of the lobby menu, the first is the default
+var glyphSets = []*glyphSet{
+	{name: "braille", filled: '⣿', top: '⠛', bottom: '⣤', faded: '⠶', trail: '⠶', window: '⠒', rows: 2, cols: 1},
+	{name: "block", filled: '█', top: '▀', bottom: '▄', faded: '▒', trail: '▒', window: '░', rows: 2, cols: 1},
+	{name: "ascii", filled: '#', top: '-', bottom: '-', faded: ':', trail: ':', window: '.', ascii: true, rows: 1, cols: 1},
+	{name: "wide", filled: '█', top: '▀', bottom: '▄', faded: '▒', trail: '▒', window: '░', rows: 1, cols: 2},
+}
+
+// findGlyphs returns the named glyph set
+func findGlyphs(name string) (*glyphSet, bool) {
+	for _, gs := range glyphSets {
+		if strings.EqualFold(name, gs.name) {
+			return gs, true
+		}
+	}
+	return nil, false
+}
+
+// parseGlyphs pulls a glyph set off the end of the ssh username,
+// e.g. 'ssh name+ascii@host' or 'ssh name+red+ascii@host'
+func parseGlyphs(sshName string) (string, *glyphSet) {
+	if i := strings.LastIndex(sshName, "+"); i >= 0 {
+		if gs, ok := findGlyphs(sshName[i+1:]); ok {
+			return sshName[:i], gs
+		}
+	}
+	return sshName, nil
+}
+
+// parseEnv extracts the name and value from an "env" request payload
+func parseEnv(payload []byte) (string, string, bool) {
+	strs := []string{}
+	for len(strs) < 2 {
+		if len(payload) < 4 {
+			return "", "", false
+		}
+		n := binary.BigEndian.Uint32(payload)
+		if uint32(len(payload)-4) < n {
+			return "", "", false
+		}
+		strs = append(strs, string(payload[4:4+n]))
+		payload = payload[4+n:]
+	}
+	return strs[0], strs[1], true
+}
+
+// item returns the power-up's glyph
+func (gs *glyphSet) item(id ID) rune {
+	if gs.ascii {
+		return items[id].ascii
+	}
+	return items[id].glyph
+}
+
+// tile returns the rune and colour which draws the board at
+// column x, from row y, with rows tiles stacked in each rune
+func (gs *glyphSet) tile(b Board, x, y int) (rune, ID) {
+	if gs.rows == 1 {
+		switch id := b[x][y]; {
+		case id == blank:
+			return empty, blank
+		case isItem(id):
+			return gs.item(id), id
+		default:
+			return gs.filled, id
+		}
+	}
+	r, c := empty, blank
+	t, u := b[x][y], b[x][y+1]
+	// choose rune
+	if t != blank && u != blank {
+		r = gs.filled
+	} else if t != blank {
+		r = gs.top
+	} else if u != blank {
+		r = gs.bottom
+	}
+	// choose color (the bottom tile's, otherwise the top tile's)
+	if u == blank {
+		c = t
+	} else {
+		c = u
+	}
+	// power-ups cover both tiles
+	if id, ok := itemAt(t, u); ok {
+		r = gs.item(id)
+		c = id
+	}
+	return r, c
+}
@@ -0,0 +1,176 @@
+package tron
+
+import (
+	"fmt"
+	"time"
+)
+
+// where the cycle crashed
+const wreck = 'X'
+
+var (
+	// board history kept for kill-cams
+	killcamLength = 2 * time.Second
+	// time the final frame of a kill-cam is held before respawning
+	killcamHold = 500 * time.Millisecond
+)
+
+// history is the board as last remembered, and a ring buffer of
+// the tiles changed by the most recent ticks. storing changes,
+// rather than whole boards, keeps large boards small.
+type history struct {
+	last  Board
+	ticks [][]tileChange
+	next  int // tick to overwrite
+	n     int // frames stored
+}
+
+// tileChange is a tile which changed during a tick
+type tileChange struct {
+	x, y int
+	was  ID
+}
+
+func newHistory(width, height, frames int) *history {
+	hs := &history{
+		last:  make(Board, width),
+		ticks: make([][]tileChange, frames),
+	}
+	for w := range hs.last {
+		hs.last[w] = make([]ID, height)
+	}
+	return hs
+}
+
+// remember stores the changes since the last board, overwriting
+// the oldest
+func (hs *history) remember(b Board) {
+	var changes []tileChange
+	for w := range b {
+		for h, id := range b[w] {
+			if was := hs.last[w][h]; id != was {
+				changes = append(changes, tileChange{w, h, was})
+				hs.last[w][h] = id
+			}
+		}
+	}
+	if hs.n == 0 {
+		// the first board has nothing to undo
+		hs.n++
+		return
+	}
+	hs.ticks[hs.next] = changes
+	hs.next = (hs.next + 1) % len(hs.ticks)
+	if hs.n < len(hs.ticks) {
+		hs.n++
+	}
+}
+
+// recent returns the n most recent frames, oldest first, cropped
+// to the width by height window at (ox, oy)
+func (hs *history) recent(n, ox, oy, width, height int) []Board {
+	frames := make([]Board, n)
+	f := make(Board, width)
+	for w := range f {
+		f[w] = append([]ID(nil), hs.last[ox+w][oy:oy+height]...)
+	}
+	frames[n-1] = f
+	// undo each tick's changes to find the frame before it
+	for i := n - 2; i >= 0; i-- {
+		prev := make(Board, width)
+		for w := range prev {
+			prev[w] = append([]ID(nil), f[w]...)
+		}
+		tick := (hs.next - (n - 1 - i) + len(hs.ticks)) % len(hs.ticks)
+		for _, c := range hs.ticks[tick] {
+			if x, y := c.x-ox, c.y-oy; x >= 0 && y >= 0 && x < width && y < height {
+				prev[x][y] = c.was
+			}
+		}
+		frames[i], f = prev, prev
+	}
+	return frames
+}
+
+// killcam replays the moments before a player's death, zoomed in
+// around the crash, while they wait to respawn
+type killcam struct {
+	frames         []Board // one tile per terminal cell
+	frame          int     // current frame
+	victim, killer ID
+	x, y           int // crash, within the frames
+	caption        string
+}
+
+// startKillcam gives the player a kill-cam of their death,
+// when there's time to watch it before respawning
+func (g *Game) startKillcam(p *Player, killer *Player) {
+	if g.history == nil || p.ai != nil || !g.playing(p) {
+		return
+	}
+	n := int((g.RespawnDelay - killcamHold) / g.GameSpeed)
+	if n > g.history.n {
+		n = g.history.n
+	}
+	if n < 1 {
+		return
+	}
+	// the frames are the size of the player's window of the
+	// board, one tile per rune, centred on the crash
+	width, height := p.window()
+	crop := viewport{ox: p.x - width/2, oy: p.y - height/2}
+	crop.clamp(g.bw-width, g.bh-height)
+	k := &killcam{
+		victim:  p.id,
+		x:       p.x - crop.ox,
+		y:       p.y - crop.oy,
+		caption: " KILL-CAM  crashed ",
+	}
+	if killer != nil {
+		k.killer = killer.id
+		k.caption = fmt.Sprintf(" KILL-CAM  killed by %s ", killer.Name)
+	}
+	k.frames = g.history.recent(n, crop.ox, crop.oy, width, height)
+	p.killcam = k
+}
+
+// next moves on to the next frame, holding the last
+func (k *killcam) next() {
+	if k != nil && k.frame < len(k.frames)-1 {
+		k.frame++
+	}
+}
+
+// window returns the top left of a width by height
+// window of the frames, centred on the crash
+func (k *killcam) window(width, height int) (int, int) {
+	v := viewport{ox: k.x - width/2, oy: k.y - height/2}
+	v.clamp(len(k.frames[0])-width, len(k.frames[0][0])-height)
+	return v.ox, v.oy
+}
+
+// captionRune returns the rune of the caption, centred
+// along the top of a window width wide, at column w
+func (k *killcam) captionRune(w, width int) (rune, bool) {
+	if i := w - (width-len(k.caption))/2; i >= 0 && i < len(k.caption) {
+		return rune(k.caption[i]), true
+	}
+	return empty, false
+}
+
+// tile returns the rune and colour at location (w, h) of the
+// frames. the killer's and victim's trails stand out.
+func (k *killcam) tile(gs *glyphSet, w, h int) (rune, ID) {
+	id := k.frames[k.frame][w][h]
+	switch {
+	case k.frame == len(k.frames)-1 && w == k.x && h == k.y:
+		return wreck, k.victim
+	case id == blank:
+		return empty, blank
+	case isItem(id):
+		return gs.item(id), id
+	case id == wall || id == k.victim || id == k.killer:
+		return gs.filled, id
+	}
+	return gs.faded, id
+}
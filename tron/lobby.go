@@ -0,0 +1,365 @@
+package tron
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultArena = "main"
+	maxArenas    = 8
+	// created arenas close when nobody has been in them this long
+	arenaIdle = time.Minute
+)
+
+// limits of arenas created by players, unless the server's own
+// settings are larger
+const (
+	maxArenaSize    = 128
+	maxArenaPlayers = 16
+	minArenaSpeed   = 20 * time.Millisecond
+)
+
+var arenaName = regexp.MustCompile(`^\w{1,12}$`)
+
+var lobbyUsage = strings.Join([]string{
+	"Usage: ssh <host> [command]",
+	"",
+	"Commands:",
+	"  (none)                  show the lobby screen",
+	"  join [arena]            join an arena (default main)",
+	"  spectate [arena]        watch an arena",
+	"  list                    list arenas",
+	"  create <arena> [flags]  create an arena and join it",
+	"  replay [name]           watch a replay, or list them",
+	"",
+	"Create flags:",
+	"  --width N, --height N, --speed DURATION, --mode MODE,",
+	"  --max-players N, --kill-limit N, --teams N, --bots N,",
+	"  --power-ups, --wrap, --map cross|pillars|maze",
+	"",
+}, "\r\n")
+
+// Lobby owns the ssh server, the database and the chat bot, and
+// routes each new connection into one of its arenas (games)
+type Lobby struct {
+	Config
+	db     *Database
+	server *Server
+	bot    *Bot
+	mut    sync.Mutex
+	arenas map[string]*Game
+	online map[string]presence // public key hash => presence
+	logf   func(format string, args ...interface{})
+}
+
+// NewLobby returns an initialized Lobby, with a main arena
+// according to the input arguments. The main() function
+// should call the Play() method on this Lobby.
+func NewLobby(c Config) (*Lobby, error) {
+	if err := validate(&c); err != nil {
+		return nil, err
+	}
+	db, err := NewDatabase(c.DBLocation, c.DBReset)
+	if err != nil {
+		return nil, err
+	}
+	server, err := NewServer(db, c.Port)
+	if err != nil {
+		return nil, err
+	}
+	l := &Lobby{
+		Config: c,
+		db:     db,
+		server: server,
+		bot:    &Bot{mode: c.Mode},
+		arenas: map[string]*Game{},
+		online: map[string]presence{},
+		logf:   log.New(os.Stdout, "lobby: ", 0).Printf,
+	}
+	// initialise slack if provided
+	if t := c.SlackToken; t != "" {
+		ch := c.SlackChannel
+		if ch == "" {
+			return nil, errors.New("Slack channel must also be specified (--slack-channel)")
+		}
+		if err := l.bot.init(t, ch); err != nil {
+			return nil, err
+		}
+		motd := "tron server started\n"
+		if l.JoinAddress != "" {
+			motd += fmt.Sprintf("join using: `ssh %s`", l.JoinAddress)
+		} else {
+			motd += fmt.Sprintf("join using:\n```\n%s\n```\n", l.server.addresses)
+		}
+		if err := l.bot.message(motd); err != nil {
+			return nil, err
+		}
+		go l.bot.start()
+	}
+	g, err := newGame(defaultArena, c, l)
+	if err != nil {
+		return nil, err
+	}
+	l.arenas[defaultArena] = g
+	return l, nil
+}
+
+func (l *Lobby) Play() {
+	l.arena(defaultArena).start()
+	// watch signals (catch Ctrl+C and gracefully shutdown)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, os.Kill)
+	go l.watch(c)
+	addr := l.JoinAddress
+	if addr == "" {
+		addr = "\n" + l.server.addresses
+	}
+	// start the ssh server
+	go l.server.start()
+	l.logf("server up (fingerprint %s)\njoin at: %s\n", fingerprintKey(l.server.privateKey.PublicKey()), addr)
+	// handle incoming players forever (channel never closed)
+	for p := range l.server.newPlayers {
+		go l.route(p)
+	}
+}
+
+func (l *Lobby) watch(c chan os.Signal) {
+	<-c
+	l.mut.Lock()
+	arenas := make([]*Game, 0, len(l.arenas))
+	for _, g := range l.arenas {
+		arenas = append(arenas, g)
+	}
+	l.mut.Unlock()
+	for _, g := range arenas {
+		g.stop()
+	}
+	l.db.Close()
+	time.Sleep(300 * time.Millisecond)
+	os.Exit(0)
+}
+
+// route runs the player's command, which usually places them in
+// an arena. players without a command choose from the lobby screen.
+func (l *Lobby) route(p *Player) {
+	go p.recieveActions()
+	l.db.loadPrefs(p)
+	if p.command == "" {
+		p.command = p.menu(l)
+	}
+	args := strings.Fields(p.command)
+	cmd := ""
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	name := defaultArena
+	switch cmd {
+	case "join":
+		if len(args) > 0 {
+			name = args[0]
+		}
+	case cmdSpectate:
+		p.spectating = true
+		p.Name = "spectator"
+		if len(args) > 0 {
+			name = args[0]
+		}
+	case "quit":
+		p.teardown()
+		return
+	case "list":
+		l.reply(p, l.list())
+		return
+	case "replay":
+		if len(args) == 0 {
+			l.reply(p, l.replays())
+			return
+		}
+		g, err := l.replay(args[0])
+		if err != nil {
+			l.reply(p, fmt.Sprintf("Could not play replay: %s\r\n\r\n%s", err, l.replays()))
+			return
+		}
+		p.logf("watching replay %s", args[0])
+		p.spectating = true
+		p.Name = "spectator"
+		g.handle(p)
+		return
+	case "create":
+		g, err := l.create(args)
+		if err != nil {
+			l.reply(p, fmt.Sprintf("Could not create arena: %s\r\n\r\n%s", err, lobbyUsage))
+			return
+		}
+		p.logf("created arena %s", g.name)
+		name = g.name
+	default:
+		l.reply(p, lobbyUsage)
+		return
+	}
+	g := l.arena(name)
+	if g == nil {
+		l.reply(p, fmt.Sprintf("No such arena: %s\r\n\r\n%s", name, l.list()))
+		return
+	}
+	if !p.spectating {
+		if other, ok := l.claim(p, name); !ok {
+			p.logf("rejected - already connected in arena %s", other)
+			l.reply(p, fmt.Sprintf("Already connected in arena %s\r\n", other))
+			return
+		}
+	}
+	g.handle(p)
+}
+
+// reply sends the player a message and disconnects them
+func (l *Lobby) reply(p *Player, msg string) {
+	p.farewell = msg
+	p.teardown()
+}
+
+func (l *Lobby) arena(name string) *Game {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return l.arenas[name]
+}
+
+// list renders a table of arenas
+func (l *Lobby) list() string {
+	l.mut.Lock()
+	names := make([]string, 0, len(l.arenas))
+	for name := range l.arenas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []string{fmt.Sprintf("%-12s %-12s %-7s %-6s %-9s %s", "ARENA", "MODE", "SIZE", "SPEED", "PLAYERS", "WATCHING")}
+	for _, name := range names {
+		g := l.arenas[name]
+		i := g.snapshot()
+		players := fmt.Sprintf("%d/%d", i.players, g.MaxPlayers)
+		if i.queued > 0 {
+			players += fmt.Sprintf("+%d", i.queued)
+		}
+		lines = append(lines, fmt.Sprintf("%-12s %-12s %-7s %-6s %-9s %d", name, g.Mode,
+			fmt.Sprintf("%dx%d", g.Width, g.Height), g.GameSpeed, players, i.spectators))
+	}
+	l.mut.Unlock()
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// create starts a new arena, args are its name then any flags
+func (l *Lobby) create(args []string) (*Game, error) {
+	if len(args) == 0 || !arenaName.MatchString(args[0]) {
+		return nil, errors.New("arena name must be 1-12 letters or numbers")
+	}
+	name := args[0]
+	c := l.Config
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.IntVar(&c.Width, "width", c.Width, "")
+	fs.IntVar(&c.Height, "height", c.Height, "")
+	fs.DurationVar(&c.GameSpeed, "speed", c.GameSpeed, "")
+	fs.StringVar(&c.Mode, "mode", c.Mode, "")
+	fs.IntVar(&c.MaxPlayers, "max-players", c.MaxPlayers, "")
+	fs.IntVar(&c.KillLimit, "kill-limit", c.KillLimit, "")
+	fs.IntVar(&c.Teams, "teams", c.Teams, "")
+	fs.IntVar(&c.Bots, "bots", c.Bots, "")
+	fs.BoolVar(&c.PowerUps, "power-ups", c.PowerUps, "")
+	fs.StringVar(&c.Map, "map", c.Map, "")
+	fs.BoolVar(&c.Wrap, "wrap", c.Wrap, "")
+	if err := fs.Parse(args[1:]); err != nil {
+		return nil, err
+	}
+	// bot programs only play in the main arena
+	c.BotPrograms = ""
+	// players may not load files from the server
+	if _, ok := builtinMaps[c.Map]; c.Map != l.Map && !ok {
+		return nil, fmt.Errorf("map must be one of: %s", strings.Join(builtinMapNames(), ", "))
+	}
+	if c.GameSpeed < minArenaSpeed && c.GameSpeed != l.GameSpeed {
+		return nil, fmt.Errorf("speed must be at least %s", minArenaSpeed)
+	}
+	if (c.Width > maxArenaSize && c.Width != l.Width) || (c.Height > maxArenaSize && c.Height != l.Height) {
+		return nil, fmt.Errorf("width and height must be at most %d", maxArenaSize)
+	}
+	if c.MaxPlayers > maxArenaPlayers && c.MaxPlayers != l.MaxPlayers {
+		return nil, fmt.Errorf("max players must be at most %d", maxArenaPlayers)
+	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if _, ok := l.arenas[name]; ok {
+		return nil, fmt.Errorf("arena %s already exists", name)
+	}
+	if len(l.arenas) >= maxArenas {
+		return nil, fmt.Errorf("too many arenas (max %d)", maxArenas)
+	}
+	g, err := newGame(name, c, l)
+	if err != nil {
+		return nil, err
+	}
+	l.arenas[name] = g
+	g.start()
+	return g, nil
+}
+
+// remove forgets the arena, once its game loop has stopped
+func (l *Lobby) remove(g *Game) {
+	l.mut.Lock()
+	if l.arenas[g.name] == g {
+		delete(l.arenas, g.name)
+	}
+	l.mut.Unlock()
+}
+
+// presence is an online player, shown on the lobby screen
+type presence struct {
+	name, arena string
+}
+
+// claim marks the player as online in the given arena, players
+// may only be connected once across all arenas
+func (l *Lobby) claim(p *Player, arena string) (string, bool) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if other, ok := l.online[p.hash]; ok {
+		return other.arena, false
+	}
+	name := p.Name
+	if name == "" {
+		name = p.SSHName
+	}
+	l.online[p.hash] = presence{name, arena}
+	return arena, true
+}
+
+// release marks the player as offline, called by the game loop
+func (l *Lobby) release(p *Player) {
+	l.mut.Lock()
+	delete(l.online, p.hash)
+	l.mut.Unlock()
+}
+
+// whoIsOnline lists the online players by name
+func (l *Lobby) whoIsOnline() []presence {
+	l.mut.Lock()
+	online := make([]presence, 0, len(l.online))
+	for _, o := range l.online {
+		online = append(online, o)
+	}
+	l.mut.Unlock()
+	sort.Slice(online, func(i, j int) bool {
+		return online[i].name < online[j].name
+	})
+	return online
+}
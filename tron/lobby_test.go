@@ -0,0 +1,30 @@
+package tron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCreateLimits(t *testing.T) {
+	l := &Lobby{
+		Config: Config{Width: 64, Height: 64, MaxPlayers: 6, GameSpeed: 40 * time.Millisecond},
+		arenas: map[string]*Game{},
+	}
+	for _, args := range [][]string{
+		{"x", "--max-players", "65535"},
+		{"x", "--max-players", "255"},
+		{"x", "--max-players", "17"},
+		{"x", "--bots", "7"},
+		{"x", "--width", "512"},
+		{"x", "--height", "129"},
+		{"x", "--speed", "10ms"},
+		{"x", "--map", "/etc/passwd"},
+	} {
+		if _, err := l.create(args); err == nil {
+			t.Errorf("create %v was allowed", args)
+		}
+	}
+	if len(l.arenas) != 0 {
+		t.Errorf("%d arenas were created", len(l.arenas))
+	}
+}
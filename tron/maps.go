@@ -0,0 +1,412 @@
+package tron
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// gameMap is a board layout: its size, interior walls, edges and
+// spawn points. maps are loaded from files or built in.
+type gameMap struct {
+	name   string
+	w, h   int
+	wrap   bool
+	walls  []point
+	spawns []spawn
+}
+
+type point struct {
+	x, y int
+}
+
+// map tiles, in text maps and in the rows of JSON maps
+const (
+	mapWall  = '#'
+	mapEmpty = '.'
+)
+
+var mapSpawns = map[rune]Direction{
+	'^': dup,
+	'v': ddown,
+	'<': dleft,
+	'>': dright,
+}
+
+// builtinMaps are shipped in the binary, and fit any board size
+var builtinMaps = map[string]func(w, h int) *gameMap{
+	"cross":   crossMap,
+	"pillars": pillarsMap,
+	"maze":    mazeMap,
+}
+
+// builtinMapNames lists the built in maps
+func builtinMapNames() []string {
+	names := []string{}
+	for name := range builtinMaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadMap returns the named built in map, sized w by h, otherwise
+// reads the map file, which sets its own size
+func loadMap(name string, w, h int) (*gameMap, error) {
+	if fn, ok := builtinMaps[name]; ok {
+		return fn(w, h), nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("not a file or one of: %s", strings.Join(builtinMapNames(), ", "))
+	}
+	defer f.Close()
+	if filepath.Ext(name) == ".json" {
+		return parseJSONMap(f)
+	}
+	return parseTextMap(f)
+}
+
+// parseTextMap reads a text map, optional "key: value" headers
+// (name, wrap) and a blank line, then the rows of the board:
+//
+//	name: box
+//	wrap: false
+//
+//	################################
+//	#..............................#
+//	#..>...................<.......#
+//	...
+//
+// '#' is a wall, '.' or space is empty and '^', 'v', '<' or '>'
+// is a spawn point heading in that direction
+func parseTextMap(r io.Reader) (*gameMap, error) {
+	m := &gameMap{}
+	rows := []string{}
+	headers := true
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if headers {
+			if i := strings.Index(line, ":"); i > 0 {
+				key := strings.ToLower(strings.TrimSpace(line[:i]))
+				value := strings.TrimSpace(line[i+1:])
+				switch key {
+				case "name":
+					m.name = value
+				case "wrap":
+					m.wrap = value == "true" || value == "yes"
+				default:
+					return nil, fmt.Errorf("unknown map header: %s", key)
+				}
+				continue
+			}
+			headers = false
+			if line == "" {
+				continue
+			}
+		}
+		rows = append(rows, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	// ignore trailing blank lines
+	for len(rows) > 0 && strings.TrimSpace(rows[len(rows)-1]) == "" {
+		rows = rows[:len(rows)-1]
+	}
+	if err := m.parseRows(rows); err != nil {
+		return nil, err
+	}
+	if err := m.checkSpawns(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseRows sets the map's size, walls and spawns from its rows
+func (m *gameMap) parseRows(rows []string) error {
+	if len(rows) == 0 {
+		return errors.New("map has no rows")
+	}
+	m.h = len(rows)
+	for _, row := range rows {
+		if n := len([]rune(row)); n > m.w {
+			m.w = n
+		}
+	}
+	if m.w > maxBoardSize || m.h > maxBoardSize {
+		return fmt.Errorf("map is larger than %dx%d", maxBoardSize, maxBoardSize)
+	}
+	for y, row := range rows {
+		for x, c := range []rune(row) {
+			p := point{x, y}
+			if d, ok := mapSpawns[c]; ok {
+				m.spawns = append(m.spawns, spawn{p.x, p.y, d})
+				continue
+			}
+			switch c {
+			case mapWall:
+				m.walls = append(m.walls, p)
+			case mapEmpty, ' ':
+			default:
+				return fmt.Errorf("unknown tile %q at row %d column %d", c, y+1, x+1)
+			}
+		}
+	}
+	return nil
+}
+
+// jsonMap is a map in JSON, either with rows like a text map,
+// or with a size, wall rectangles and spawn points
+type jsonMap struct {
+	Name   string   `json:"name"`
+	Width  int      `json:"width"`
+	Height int      `json:"height"`
+	Wrap   bool     `json:"wrap"`
+	Rows   []string `json:"rows"`
+	Walls  []struct {
+		X, Y, W, H int
+	} `json:"walls"`
+	Spawns []struct {
+		X, Y      int
+		Direction string
+	} `json:"spawns"`
+}
+
+func parseJSONMap(r io.Reader) (*gameMap, error) {
+	j := jsonMap{}
+	if err := json.NewDecoder(r).Decode(&j); err != nil {
+		return nil, err
+	}
+	m := &gameMap{name: j.Name, w: j.Width, h: j.Height, wrap: j.Wrap}
+	if len(j.Rows) > 0 {
+		if err := m.parseRows(j.Rows); err != nil {
+			return nil, err
+		}
+	}
+	if m.w <= 0 || m.h <= 0 || m.w > maxBoardSize || m.h > maxBoardSize {
+		return nil, fmt.Errorf("map width and height must be between 1-%d", maxBoardSize)
+	}
+	inside := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < m.w && y < m.h
+	}
+	for _, rect := range j.Walls {
+		for x := rect.X; x < rect.X+rect.W; x++ {
+			for y := rect.Y; y < rect.Y+rect.H; y++ {
+				if !inside(x, y) {
+					return nil, fmt.Errorf("wall (%d,%d) is outside the map", x, y)
+				}
+				m.walls = append(m.walls, point{x, y})
+			}
+		}
+	}
+	for _, s := range j.Spawns {
+		d, err := parseDirection(s.Direction)
+		if err != nil {
+			return nil, fmt.Errorf("spawn (%d,%d): %s", s.X, s.Y, err)
+		}
+		m.spawns = append(m.spawns, spawn{s.X, s.Y, d})
+	}
+	if err := m.checkSpawns(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// checkSpawns rejects spawn points outside the map, on its walls,
+// or on the border walls of a board which doesn't wrap
+func (m *gameMap) checkSpawns() error {
+	walls := map[point]bool{}
+	for _, p := range m.walls {
+		walls[p] = true
+	}
+	for _, s := range m.spawns {
+		x, y := s.x, s.y
+		switch {
+		case x < 0 || y < 0 || x >= m.w || y >= m.h:
+			return fmt.Errorf("spawn (%d,%d) is outside the map", x, y)
+		case walls[point{x, y}]:
+			return fmt.Errorf("spawn (%d,%d) is on a wall", x, y)
+		case !m.wrap && (x == 0 || y == 0 || x == m.w-1 || y == m.h-1):
+			return fmt.Errorf("spawn (%d,%d) is on the border", x, y)
+		}
+	}
+	return nil
+}
+
+// load builds the map's walls, edges and spawn points into the
+// engine, whose board must be the map's size
+func (e *engine) load(m *gameMap) {
+	if m.wrap {
+		e.wrapEdges()
+	}
+	for _, p := range m.walls {
+		e.board[p.x][p.y] = wall
+	}
+	e.spawns = m.spawns
+}
+
+// box adds a rectangle of wall to the map
+func (m *gameMap) box(x, y, w, h int) {
+	for i := x; i < x+w; i++ {
+		for j := y; j < y+h; j++ {
+			m.walls = append(m.walls, point{i, j})
+		}
+	}
+}
+
+// crossMap has a cross in the middle, with a gap where the arms meet
+func crossMap(w, h int) *gameMap {
+	m := &gameMap{name: "cross", w: w, h: h}
+	cx, cy := w/2, h/2
+	const gap = 3
+	aw, ah := w/4-gap, h/4-gap
+	m.box(cx-gap-aw, cy-1, aw, 2)
+	m.box(cx+gap, cy-1, aw, 2)
+	m.box(cx-1, cy-gap-ah, 2, ah)
+	m.box(cx-1, cy+gap, 2, ah)
+	// spawn alongside the arms, heading away from the middle
+	lx, rx := cx-gap-aw/2, cx+gap+aw/2
+	ty, by := cy-gap-ah/2, cy+gap+ah/2
+	m.spawns = []spawn{
+		{lx, cy - 4, dleft},
+		{rx, cy + 4, dright},
+		{cx + 4, ty, dup},
+		{cx - 4, by, ddown},
+		{lx, cy + 4, dleft},
+		{rx, cy - 4, dright},
+		{cx - 4, ty, dup},
+		{cx + 4, by, ddown},
+	}
+	return m
+}
+
+// pillarsMap has a grid of square pillars
+func pillarsMap(w, h int) *gameMap {
+	m := &gameMap{name: "pillars", w: w, h: h}
+	const spacing, size = 10, 2
+	nx, ny := (w-spacing)/spacing, (h-spacing)/spacing
+	// centre the grid of pillars
+	ox, oy := (w-(nx-1)*spacing)/2, (h-(ny-1)*spacing)/2
+	for i := 0; i < nx; i++ {
+		for j := 0; j < ny; j++ {
+			m.box(ox+i*spacing-size/2, oy+j*spacing-size/2, size, size)
+		}
+	}
+	// spawn in the lanes between the pillars, heading along them
+	for i := 0; i < nx-1; i++ {
+		x := ox + i*spacing + spacing/2
+		if i%2 == 0 {
+			m.spawns = append(m.spawns, spawn{x, oy - spacing/2, ddown})
+		} else {
+			m.spawns = append(m.spawns, spawn{x, h - oy + spacing/2, dup})
+		}
+	}
+	for j := 0; j < ny-1; j++ {
+		y := oy + j*spacing + spacing/2
+		if j%2 == 0 {
+			m.spawns = append(m.spawns, spawn{w - ox + spacing/2, y, dleft})
+		} else {
+			m.spawns = append(m.spawns, spawn{ox - spacing/2, y, dright})
+		}
+	}
+	return m
+}
+
+// mazeMap has walls between wide cells, with a passage through
+// every cell. the maze is the same for each board size.
+func mazeMap(w, h int) *gameMap {
+	m := &gameMap{name: "maze", w: w, h: h}
+	const cell = 8
+	cw, ch := (w-2)/cell, (h-2)/cell
+	// margins, so the maze is centred
+	ox, oy := (w-cw*cell)/2, (h-ch*cell)/2
+	r := rand.New(rand.NewSource(int64(w*256 + h)))
+	// carve passages (depth first), then open some extra
+	// walls so there's more than one way around
+	right := make([][]bool, cw) // wall to the right of a cell is open
+	down := make([][]bool, cw)  // wall below a cell is open
+	seen := make([][]bool, cw)
+	for x := 0; x < cw; x++ {
+		right[x] = make([]bool, ch)
+		down[x] = make([]bool, ch)
+		seen[x] = make([]bool, ch)
+	}
+	stack := []point{{0, 0}}
+	seen[0][0] = true
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		x, y := c.x, c.y
+		next := []point{}
+		for _, d := range directions {
+			nx, ny := Ahead(x, y, d)
+			if nx >= 0 && ny >= 0 && nx < cw && ny < ch && !seen[nx][ny] {
+				next = append(next, point{nx, ny})
+			}
+		}
+		if len(next) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		n := next[r.Intn(len(next))]
+		nx, ny := n.x, n.y
+		switch {
+		case nx > x:
+			right[x][y] = true
+		case nx < x:
+			right[nx][y] = true
+		case ny > y:
+			down[x][y] = true
+		default:
+			down[x][ny] = true
+		}
+		seen[nx][ny] = true
+		stack = append(stack, n)
+	}
+	for x := 0; x < cw; x++ {
+		for y := 0; y < ch; y++ {
+			if r.Intn(4) == 0 {
+				right[x][y] = true
+			}
+			if r.Intn(4) == 0 {
+				down[x][y] = true
+			}
+		}
+	}
+	// build the closed walls, the outside is the board's border
+	for x := 0; x < cw; x++ {
+		for y := 0; y < ch; y++ {
+			px, py := ox+x*cell, oy+y*cell
+			if x < cw-1 && !right[x][y] {
+				m.box(px+cell, py, 1, cell+1)
+			}
+			if y < ch-1 && !down[x][y] {
+				m.box(px, py+cell, cell+1, 1)
+			}
+		}
+	}
+	// spawn in the middle of cells, heading through an open wall
+	for x := 0; x < cw; x += 2 {
+		for y := 0; y < ch; y += 2 {
+			s := spawn{ox + x*cell + cell/2, oy + y*cell + cell/2, dup}
+			switch {
+			case x < cw-1 && right[x][y]:
+				s.d = dright
+			case y < ch-1 && down[x][y]:
+				s.d = ddown
+			case x > 0 && right[x-1][y]:
+				s.d = dleft
+			}
+			m.spawns = append(m.spawns, s)
+		}
+	}
+	return m
+}
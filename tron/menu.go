@@ -0,0 +1,258 @@
+package tron
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jpillora/ansi"
+)
+
+// rows of the lobby menu
+const (
+	rowArena = iota
+	rowColour
+	rowGlyphs
+	rowTheme
+	rowJoin
+	rowSpectate
+	rowQuit
+	menuRows
+)
+
+const (
+	menuLeaders = 5  // players shown on the leaderboard
+	menuOnline  = 10 // online players shown
+)
+
+// time between redraws of the lobby menu
+var menuRefresh = 2 * time.Second
+
+// menu is the lobby screen shown to players who connect
+// without a command, before they enter an arena
+type menu struct {
+	l       *Lobby
+	p       *Player
+	row     int
+	arenas  []string
+	arena   int
+	colour  int // 0 is automatic, otherwise namedColours[colour-1]
+	glyphs  int // index of glyphSets
+	theme   int // index of themes
+	leaders []*Player
+}
+
+// menu shows the lobby screen until the player makes a choice,
+// it runs in place of the game loop and returns a lobby command
+func (p *Player) menu(l *Lobby) string {
+	m := &menu{l: l, p: p, row: rowJoin}
+	for i, gs := range glyphSets {
+		if gs == p.glyphs {
+			m.glyphs = i
+		}
+	}
+	for i, t := range themes {
+		if t == p.theme {
+			m.theme = i
+		}
+	}
+	for i, c := range namedColours {
+		if c.name == p.Colour {
+			m.colour = i + 1
+		}
+	}
+	m.refresh()
+	tick := time.NewTicker(menuRefresh)
+	defer tick.Stop()
+	resizes := p.resizes
+	p.conn.CursorHide()
+	for {
+		m.render()
+		select {
+		case b, ok := <-p.actions:
+			if !ok {
+				return "quit"
+			}
+			if cmd := m.action(b); cmd != "" {
+				return cmd
+			}
+		case r, ok := <-resizes:
+			if !ok {
+				resizes = nil
+				continue
+			}
+			// remembered for when the game starts
+			p.size = r
+		case <-tick.C:
+			m.refresh()
+		}
+	}
+}
+
+// refresh reloads the arena list and the leaderboard
+func (m *menu) refresh() {
+	selected := defaultArena
+	if m.arena < len(m.arenas) {
+		selected = m.arenas[m.arena]
+	}
+	m.l.mut.Lock()
+	m.arenas = m.arenas[:0]
+	for name := range m.l.arenas {
+		m.arenas = append(m.arenas, name)
+	}
+	m.l.mut.Unlock()
+	sort.Strings(m.arenas)
+	m.arena = 0
+	for i, name := range m.arenas {
+		if name == selected {
+			m.arena = i
+		}
+	}
+	if ps, err := m.l.db.loadAll(); err == nil {
+		sort.Sort(byScore{mode: m.l.Mode, ps: ps})
+		if len(ps) > menuLeaders {
+			ps = ps[:menuLeaders]
+		}
+		m.leaders = ps
+	}
+}
+
+// action handles a chunk of input, returning a command once chosen
+func (m *menu) action(b []byte) string {
+	if len(b) == 3 && b[0] == ansi.Esc && b[1] == 91 {
+		switch Direction(b[2]) {
+		case dup:
+			m.row = (m.row + menuRows - 1) % menuRows
+		case ddown:
+			m.row = (m.row + 1) % menuRows
+		case dleft:
+			m.change(-1)
+		case dright:
+			m.change(1)
+		}
+		return ""
+	}
+	switch b[0] {
+	case 'q':
+		return "quit"
+	case 13:
+		arena := m.arenas[m.arena]
+		switch m.row {
+		case rowQuit:
+			return "quit"
+		case rowSpectate:
+			m.choose()
+			return cmdSpectate + " " + arena
+		}
+		m.choose()
+		return "join " + arena
+	}
+	return ""
+}
+
+// change cycles the value in the current row
+func (m *menu) change(delta int) {
+	switch m.row {
+	case rowArena:
+		n := len(m.arenas)
+		m.arena = (m.arena + n + delta) % n
+	case rowColour:
+		n := len(namedColours) + 1
+		m.colour = (m.colour + n + delta) % n
+	case rowGlyphs:
+		n := len(glyphSets)
+		m.glyphs = (m.glyphs + n + delta) % n
+	case rowTheme:
+		n := len(themes)
+		m.theme = (m.theme + n + delta) % n
+	}
+}
+
+// choose applies the chosen glyphs, theme and colour to the
+// player, and saves their colour. in team arenas the colour is
+// also the requested team.
+func (m *menu) choose() {
+	m.p.glyphs = glyphSets[m.glyphs]
+	m.p.theme = themes[m.theme]
+	m.p.Colour = ""
+	if m.colour > 0 {
+		c := namedColours[m.colour-1]
+		m.p.Colour = c.name
+		m.p.teamRequest = c.name
+	}
+	m.l.db.savePrefs(m.p.hash, m.p.prefs())
+}
+
+// render redraws the whole menu
+func (m *menu) render() {
+	reset := string(ansi.Set(ansi.Reset))
+	lines := []string{"", "  " + string(ansi.Set(ansi.Bright)) + "TRON" + reset, ""}
+	// choices, the current row is highlighted
+	row := func(i int, s string) {
+		if i == m.row {
+			s = string(ansi.Set(ansi.Reverse)) + s + reset
+		}
+		lines = append(lines, "  "+s)
+	}
+	row(rowArena, fmt.Sprintf(" arena   < %-12s > ", m.arenas[m.arena]))
+	colour := fmt.Sprintf("%-12s", "auto")
+	if m.colour > 0 {
+		c := namedColours[m.colour-1]
+		colour = string(themes[m.theme].colour(c.name).escape(m.p.depth)) + fmt.Sprintf("%-12s", c.name) + reset
+	}
+	row(rowColour, " colour  < "+colour+" > ")
+	row(rowGlyphs, fmt.Sprintf(" glyphs  < %-12s > ", glyphSets[m.glyphs].name))
+	row(rowTheme, fmt.Sprintf(" theme   < %-12s > ", themes[m.theme].name))
+	lines = append(lines, "")
+	row(rowJoin, " join ")
+	row(rowSpectate, " spectate ")
+	row(rowQuit, " quit ")
+	lines = append(lines, "")
+	// selected arena's settings
+	if g := m.l.arena(m.arenas[m.arena]); g != nil {
+		i := g.snapshot()
+		lines = append(lines,
+			fmt.Sprintf("  %s: %s mode, %dx%d, speed %s", g.name, g.Mode, g.Width, g.Height, g.GameSpeed),
+			fmt.Sprintf("  %d/%d playing, %d queued, %d watching", i.players, g.MaxPlayers, i.queued, i.spectators))
+		extra := []string{}
+		if g.KillLimit > 0 {
+			extra = append(extra, fmt.Sprintf("kill limit %d", g.KillLimit))
+		}
+		if g.Teams > 0 {
+			extra = append(extra, fmt.Sprintf("%d teams", g.Teams))
+		}
+		if g.Bots > 0 {
+			extra = append(extra, fmt.Sprintf("bots fill %d slots", g.Bots))
+		}
+		if g.ResetOnDeath {
+			extra = append(extra, "reset on death")
+		}
+		if len(extra) > 0 {
+			lines = append(lines, "  "+strings.Join(extra, ", "))
+		}
+		lines = append(lines, "")
+	}
+	// who's online
+	online := m.l.whoIsOnline()
+	lines = append(lines, fmt.Sprintf("  online (%d)", len(online)))
+	for i, o := range online {
+		if i == menuOnline {
+			lines = append(lines, fmt.Sprintf("    and %d more", len(online)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("    %-16s %s", o.name, o.arena))
+	}
+	lines = append(lines, "")
+	// all time leaders
+	lines = append(lines, "  leaderboard")
+	for i, p := range m.leaders {
+		v, unit := headline(m.l.Mode, p)
+		lines = append(lines, fmt.Sprintf("    %d. %-16s %d %s", i+1, p.Name, v, unit))
+	}
+	lines = append(lines, "",
+		"  up/down select, left/right change, enter choose, q quit")
+	m.p.conn.EraseScreen()
+	m.p.conn.Goto(1, 1)
+	m.p.conn.Write([]byte(strings.Join(lines, "\r\n")))
+}
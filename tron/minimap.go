@@ -0,0 +1,90 @@
+package tron
+
+// the minimap sits at the bottom of the sidebar, inside its borders
+const minimapWidth = sidebarWidth - 2
+
+// minimap is the whole board shrunk into the sidebar, shown to
+// players who only see a window of the board
+type minimap struct {
+	w, h  int
+	cells [][]ID // the colour of a trail in each cell, otherwise blank
+}
+
+// minimapHeight keeps the board's shape, each rune is one tile
+// wide and two tiles high
+func (g *Game) minimapHeight() int {
+	h := minimapWidth * g.bh / 2 / g.bw
+	if h < 1 {
+		h = 1
+	}
+	return h
+}
+
+// windowed reports whether the player only sees part of the board
+func (p *Player) windowed() bool {
+	bw, bh := p.boardSize()
+	return p.view.w < sidebarWidth+bw || p.view.h < bh
+}
+
+// renderMinimap shrinks the board, once per tick, when any
+// player needs it
+func (g *Game) renderMinimap() {
+	needed := false
+	for _, p := range g.currPlayers {
+		needed = needed || (p.ready && p.windowed())
+	}
+	for p := range g.spectators {
+		needed = needed || (p.ready && p.windowed())
+	}
+	if !needed {
+		g.minimap = nil
+		return
+	}
+	m := g.minimap
+	if m == nil {
+		m = &minimap{w: minimapWidth, h: g.minimapHeight()}
+		m.cells = make([][]ID, m.w)
+		for x := range m.cells {
+			m.cells[x] = make([]ID, m.h)
+		}
+		g.minimap = m
+	}
+	for x := range m.cells {
+		for y := range m.cells[x] {
+			m.cells[x][y] = blank
+		}
+	}
+	for w := 0; w < g.bw; w++ {
+		x := w * m.w / g.bw
+		for h := 0; h < g.bh; h++ {
+			if id := g.board[w][h]; id != blank && id != wall && !isItem(id) {
+				m.cells[x][h*m.h/g.bh] = id
+			}
+		}
+	}
+}
+
+// minimapRune returns the rune and colour of the minimap at
+// cell (x, y), marking the player's cycle and window
+func (p *Player) minimapRune(x, y int) (rune, ID) {
+	g := p.g
+	m := g.minimap
+	// the board tiles in this cell
+	x0, x1 := x*g.bw/m.w, (x+1)*g.bw/m.w
+	y0, y1 := y*g.bh/m.h, (y+1)*g.bh/m.h
+	gs := p.glyphs
+	if p.riding() && p.x >= x0 && p.x < x1 && p.y >= y0 && p.y < y1 {
+		return gs.filled, p.id
+	}
+	if id := m.cells[x][y]; id != blank {
+		return gs.trail, id
+	}
+	// middle of the cell is in the window
+	cx, cy := (x0+x1)/2, (y0+y1)/2/gs.rows
+	v := p.view
+	ww, wh := p.window()
+	if cx >= v.ox && cx < v.ox+ww && cy >= v.oy && cy < v.oy+wh {
+		return gs.window, blank
+	}
+	return empty, blank
+}
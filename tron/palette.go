@@ -0,0 +1,290 @@
+package tron
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jpillora/ansi"
+)
+
+// environment variables, sent over ssh, which advertise 24 bit
+// colour and choose the theme
+const (
+	colorTermEnv = "COLORTERM"
+	themeEnv     = "TRON_THEME"
+)
+
+// depth is the number of colours a player's terminal supports,
+// negotiated from the TERM and COLORTERM sent over ssh
+type depth int
+
+const (
+	depthBasic depth = iota // the 8 ansi colours, and their bright versions
+	depth256
+	depthTrue // 24 bit
+)
+
+// parseDepth guesses the terminal's colour depth
+func parseDepth(term, colorTerm string) depth {
+	switch {
+	case colorTerm == "truecolor" || colorTerm == "24bit":
+		return depthTrue
+	case strings.Contains(term, "256color") || strings.Contains(term, "direct"):
+		return depth256
+	}
+	return depthBasic
+}
+
+// playerColours are the default colours of player ids, in order,
+// once they run out they repeat. the first six match namedColours.
+var playerColours = []string{
+	"blue", "green", "magenta", "cyan", "yellow", "red",
+	"orange", "purple", "pink", "lime", "teal", "brown",
+}
+
+// basicColours are used by terminals without 256 colours,
+// so the later player colours are bright versions of the first
+var basicColours = map[string][]ansi.Attribute{
+	"blue":    {ansi.Blue},
+	"green":   {ansi.Green},
+	"magenta": {ansi.Magenta},
+	"cyan":    {ansi.Cyan},
+	"yellow":  {ansi.Yellow},
+	"red":     {ansi.Red},
+	"orange":  {ansi.Red, ansi.Bright},
+	"purple":  {ansi.Blue, ansi.Bright},
+	"pink":    {ansi.Magenta, ansi.Bright},
+	"lime":    {ansi.Green, ansi.Bright},
+	"teal":    {ansi.Cyan, ansi.Bright},
+	"brown":   {ansi.Yellow, ansi.Bright},
+}
+
+// colour is a colour at every depth
+type colour struct {
+	basic []ansi.Attribute
+	rgb   uint32
+}
+
+// brighter makes the colour stand out on basic terminals
+func (c colour) brighter() colour {
+	c.basic = append(c.basic[:len(c.basic):len(c.basic)], ansi.Bright)
+	return c
+}
+
+// escape sets the colour, replacing any earlier attributes
+func (c colour) escape(d depth) []byte {
+	r, g, b := c.rgb>>16&0xff, c.rgb>>8&0xff, c.rgb&0xff
+	switch d {
+	case depthTrue:
+		return []byte(fmt.Sprintf("%c[0;38;2;%d;%d;%dm", ansi.Esc, r, g, b))
+	case depth256:
+		// nearest colour in the 6x6x6 cube
+		return []byte(fmt.Sprintf("%c[0;38;5;%dm", ansi.Esc, 16+36*cube(r)+6*cube(g)+cube(b)))
+	}
+	return ansi.Set(append([]ansi.Attribute{ansi.Reset}, c.basic...)...)
+}
+
+// cube returns the nearest of the 256 colour cube's six levels
+// (0, 95, 135, 175, 215 and 255) to v
+func cube(v uint32) uint32 {
+	if v < 48 {
+		return 0
+	}
+	if v < 115 {
+		return 1
+	}
+	return (v - 35) / 40
+}
+
+// theme is a palette of player colours, and the colour of text,
+// walls and the sidebar
+type theme struct {
+	name    string
+	bright  bool              // basic colours are bright
+	text    colour            // text, walls and the sidebar
+	rgb     map[string]uint32 // by colour name
+	inverse *theme            // swapped in by the invert key
+}
+
+// themes in the order of the lobby menu, the first is the default
+var themes = []*theme{darkTheme, lightTheme, contrastTheme, colourBlindTheme}
+
+// players swap each theme for its inverse, on the opposite
+// background, with the invert key
+var (
+	darkTheme = &theme{
+		name: "dark",
+		text: colour{[]ansi.Attribute{ansi.White}, 0xe5e5e5},
+		rgb: map[string]uint32{
+			"blue": 0x3b78ff, "green": 0x16c60c, "magenta": 0xb148c6,
+			"cyan": 0x3ad4d4, "yellow": 0xf9f1a5, "red": 0xe74856,
+			"orange": 0xff8c1a, "purple": 0x8a5cf5, "pink": 0xff79c6,
+			"lime": 0xa6e22e, "teal": 0x1abc9c, "brown": 0xc08040,
+		},
+	}
+	lightTheme = &theme{
+		name: "light",
+		text: colour{[]ansi.Attribute{ansi.Black}, 0x202020},
+		rgb: map[string]uint32{
+			"blue": 0x0037da, "green": 0x13a10e, "magenta": 0x881798,
+			"cyan": 0x0087a0, "yellow": 0xa07800, "red": 0xc50f1f,
+			"orange": 0xca5010, "purple": 0x5c2d91, "pink": 0xc2185b,
+			"lime": 0x4c8a00, "teal": 0x00796b, "brown": 0x7a4a1a,
+		},
+	}
+	contrastTheme = &theme{
+		name:   "high-contrast",
+		bright: true,
+		text:   colour{[]ansi.Attribute{ansi.White, ansi.Bright}, 0xffffff},
+		rgb: map[string]uint32{
+			"blue": 0x0000ff, "green": 0x00ff00, "magenta": 0xff00ff,
+			"cyan": 0x00ffff, "yellow": 0xffff00, "red": 0xff0000,
+			"orange": 0xff8000, "purple": 0x8000ff, "pink": 0xff0080,
+			"lime": 0x80ff00, "teal": 0x00ff80, "brown": 0xc06000,
+		},
+	}
+	contrastLightTheme = &theme{
+		name:   "high-contrast-light",
+		bright: true,
+		text:   colour{[]ansi.Attribute{ansi.Black}, 0x000000},
+		rgb: map[string]uint32{
+			"blue": 0x0000c0, "green": 0x007000, "magenta": 0xa000a0,
+			"cyan": 0x006c80, "yellow": 0x806000, "red": 0xc00000,
+			"orange": 0xb04000, "purple": 0x5000b0, "pink": 0xc00060,
+			"lime": 0x407000, "teal": 0x007050, "brown": 0x603000,
+		},
+	}
+	// Okabe and Ito's palette, then lighter versions of it
+	colourBlindTheme = &theme{
+		name: "colour-blind",
+		text: colour{[]ansi.Attribute{ansi.White}, 0xe5e5e5},
+		rgb: map[string]uint32{
+			"blue": 0x0072b2, "green": 0x009e73, "magenta": 0xcc79a7,
+			"cyan": 0x56b4e9, "yellow": 0xf0e442, "red": 0xd55e00,
+			"orange": 0xe69f00, "purple": 0x7f6ab5, "pink": 0xe8b4cf,
+			"lime": 0x66d9b8, "teal": 0x9fd3f5, "brown": 0xf5c266,
+		},
+	}
+	// the same hues, darkened to stand out on a light background
+	colourBlindLightTheme = &theme{
+		name: "colour-blind-light",
+		text: colour{[]ansi.Attribute{ansi.Black}, 0x202020},
+		rgb: map[string]uint32{
+			"blue": 0x0072b2, "green": 0x009e73, "magenta": 0xa8487f,
+			"cyan": 0x2f86b8, "yellow": 0x8f8400, "red": 0xd55e00,
+			"orange": 0xb07800, "purple": 0x5a4690, "pink": 0xb06a90,
+			"lime": 0x2f8a70, "teal": 0x4a8fb8, "brown": 0x9a6a10,
+		},
+	}
+)
+
+func init() {
+	pair := func(a, b *theme) {
+		a.inverse, b.inverse = b, a
+	}
+	pair(darkTheme, lightTheme)
+	pair(contrastTheme, contrastLightTheme)
+	pair(colourBlindTheme, colourBlindLightTheme)
+}
+
+// findTheme returns the named theme
+func findTheme(name string) (*theme, bool) {
+	for _, t := range themes {
+		if strings.EqualFold(name, t.name) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// colour returns the named colour in this theme
+func (t *theme) colour(name string) colour {
+	c := colour{basicColours[name], t.rgb[name]}
+	if t.bright {
+		c = c.brighter()
+	}
+	return c
+}
+
+// defaultColour is the name of the id's colour, unless chosen
+func defaultColour(id ID) string {
+	if id == blank || id == wall {
+		return ""
+	}
+	return playerColours[(int(id)-1)%len(playerColours)]
+}
+
+// knownColour reports whether the colour name is in the palette
+func knownColour(name string) bool {
+	_, ok := basicColours[name]
+	return ok
+}
+
+// colourName returns the name of the colour of the given board or
+// sidebar id, players on a team share their team's colour, others
+// may choose theirs. walls and blank tiles have no name.
+func (g *Game) colourName(id ID) string {
+	if p, ok := g.currPlayers[id]; ok {
+		if p.team != nil {
+			return p.team.name
+		}
+		if p.shade != "" {
+			return p.shade
+		}
+		if p.Colour != "" {
+			return p.Colour
+		}
+	}
+	return defaultColour(id)
+}
+
+// pickColour gives a player without a team their chosen colour,
+// or their id's colour, unless another player has it, in which
+// case they get the first colour nobody has
+func (g *Game) pickColour(p *Player) {
+	p.shade = ""
+	if p.team != nil {
+		return
+	}
+	names := append([]string{p.Colour, defaultColour(p.id)}, playerColours...)
+	for _, name := range names {
+		if name != "" && !g.colourTaken(name, p.id) {
+			p.shade = name
+			break
+		}
+	}
+	if p.Colour != "" && p.shade != "" && p.shade != p.Colour {
+		p.logf("colour %s is taken, using %s", p.Colour, p.shade)
+	}
+}
+
+// colourTaken reports whether another player has the colour
+func (g *Game) colourTaken(name string, except ID) bool {
+	for id := range g.currPlayers {
+		if id != except && g.colourName(id) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// palette is the player's theme, or its opposite when inverted
+func (p *Player) palette() *theme {
+	if !p.Invert {
+		return p.theme
+	}
+	return p.theme.inverse
+}
+
+// paint returns the escape which sets the colour of the given id,
+// in the player's theme and at their terminal's depth
+func (p *Player) paint(id ID) []byte {
+	t := p.palette()
+	if it, ok := items[id]; ok {
+		return t.colour(it.colour).brighter().escape(p.depth)
+	}
+	if name := p.g.colourName(id); name != "" {
+		return t.colour(name).escape(p.depth)
+	}
+	return t.text.escape(p.depth)
+}
@@ -2,10 +2,11 @@ package tron
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"math"
-	"math/rand"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,12 +16,10 @@ import (
 
 const slotHeight = 4
 
-var (
-	filled = '⣿'
-	top    = '⠛'
-	bottom = '⣤'
-	empty  = ' '
-)
+// width of the boost energy meter in the sidebar
+const meterWidth = 5
+
+var empty = ' '
 
 type Direction byte
 
@@ -46,15 +45,17 @@ func (d Direction) String() string {
 	}
 }
 
-var colours = map[ID][]byte{
-	blank: ansi.Set(ansi.White),
-	wall:  ansi.Set(ansi.White),
-	ID(1): ansi.Set(ansi.Blue),
-	ID(2): ansi.Set(ansi.Green),
-	ID(3): ansi.Set(ansi.Magenta),
-	ID(4): ansi.Set(ansi.Cyan),
-	ID(5): ansi.Set(ansi.Yellow),
-	ID(6): ansi.Set(ansi.Red),
+// namedColours are used by teams and the colour picker
+var namedColours = []struct {
+	name   string
+	colour ansi.Attribute
+}{
+	{"red", ansi.Red},
+	{"blue", ansi.Blue},
+	{"green", ansi.Green},
+	{"yellow", ansi.Yellow},
+	{"magenta", ansi.Magenta},
+	{"cyan", ansi.Cyan},
 }
 
 type resize struct {
@@ -63,22 +64,41 @@ type resize struct {
 
 // A Player represents a live TCP connection from a client
 type Player struct {
-	id                   ID     // identification
+	rider                       // the cycle, moved by the engine
 	hash                 string //hash of public key
 	SSHName, Name, cname string
 	rank, index          int
-	x, y                 uint8     // position
-	d                    Direction // curr direction
-	nextd                Direction // next direction
-	w, h                 int       // terminal size
-	screenRunes          [][]rune  // the player's view of the screen
-	screenColors         [][]ID    // the player's view of the screen
+	w, h                 int      // terminal size
+	screenRunes          [][]rune // the player's view of the screen
+	screenColors         [][]ID   // the player's view of the screen
 	score                [slotHeight]string
 	scoreDrawn, redraw   bool
-	dead, ready, waiting bool
-	tdeath               time.Time // time of death
-	Kills, Deaths        int       // score
-	playing              chan bool // is playing signal
+	ready, waiting       bool
+	cleared              bool        // trail removed after death
+	tdeath               time.Time   // time of death
+	Kills, Deaths        int         // score
+	Wins                 int         // rounds won
+	Points, Best         int         // trail score and longest trail
+	deathStreak          int         // deaths in a row
+	farewell             string      // shown on teardown
+	teamRequest          string      // team chosen by the player
+	spectating           bool        // watching without an id
+	command              string      // requested by the ssh client
+	ai                   Strategy    // nil unless a bot
+	filler               bool        // bot making up the numbers
+	actions              chan []byte // input read from the connection
+	size                 resize      // terminal size before joining
+	Colour               string      // chosen colour name, otherwise the id's colour
+	shade                string      // colour name in this game, unless on a team
+	theme                *theme      // player colours and text colour
+	Invert               bool        // swap dark and light themes, saved
+	depth                depth       // colours the terminal supports
+	queued               bool        // waiting for an id
+	overlay              []string    // drawn over the board for this player
+	roundKills           int         // kills this round
+	killcam              *killcam    // replay of the last death, while waiting
+	view                 viewport    // part of the screen shown
+	glyphs               *glyphSet   // how the board is drawn
 	g                    *Game
 	resizes              chan resize
 	conn                 *ansi.Ansi
@@ -91,32 +111,32 @@ func NewPlayer(id ID, sshName, name, hash string, conn ssh.Channel) *Player {
 	if hash == "" {
 		hash = name //finally, hash fallsback to name
 	}
-	colouredName := fmt.Sprintf("%s%s%s", colours[id], name, ansi.Set(ansi.Reset))
+	colouredName := fmt.Sprintf("%s%s%s", themes[0].colour(defaultColour(id)).escape(depthBasic), name, ansi.Set(ansi.Reset))
 	p := &Player{
-		id:      id,
+		rider:   rider{id: id, d: dup, dead: true},
 		hash:    hash,
 		SSHName: sshName,
 		Name:    name,
 		cname:   colouredName,
-		d:       dup,
-		dead:    true,
 		ready:   false,
-		playing: make(chan bool, 1),
 		resizes: make(chan resize),
+		actions: make(chan []byte),
 		conn:    ansi.Wrap(conn),
 		logf:    log.New(os.Stdout, colouredName+" ", 0).Printf,
 		once:    &sync.Once{},
+		glyphs:  glyphSets[0],
+		theme:   themes[0],
 	}
 	return p
 }
 
 func (p *Player) resetScreen() {
-	p.screenRunes = make([][]rune, p.g.w)
-	p.screenColors = make([][]ID, p.g.w)
-	for w := 0; w < p.g.w; w++ {
-		p.screenRunes[w] = make([]rune, p.g.h)
-		p.screenColors[w] = make([]ID, p.g.h)
-		for h := 0; h < p.g.h; h++ {
+	p.screenRunes = make([][]rune, p.view.w)
+	p.screenColors = make([][]ID, p.view.w)
+	for w := 0; w < p.view.w; w++ {
+		p.screenRunes[w] = make([]rune, p.view.h)
+		p.screenColors[w] = make([]ID, p.view.h)
+		for h := 0; h < p.view.h; h++ {
 			p.screenRunes[w][h] = empty
 			p.screenColors[w][h] = ID(255)
 		}
@@ -124,57 +144,53 @@ func (p *Player) resetScreen() {
 	p.redraw = true
 }
 
-const (
-	respawnAttempts  = 100
-	respawnLookahead = 15
-)
-
 func (p *Player) respawn() {
-	if !p.dead || !p.ready || p.waiting {
+	if !p.dead || !p.ready || p.waiting || p.g.intermission() || p.g.freezing() {
 		return
 	}
-	for i := 0; i < respawnAttempts; i++ {
-		// randomly spawn player
-		p.x = uint8(rand.Intn(int(p.g.bw-2))) + 1
-		p.y = uint8(rand.Intn(int(p.g.bh-2))) + 1
-		p.d = Direction(uint8(rand.Intn(4) + 65))
-		p.nextd = p.d
-		// look ahead
-		clear := true
-		x, y := p.x, p.y
-		for j := 0; j < respawnLookahead; j++ {
-			switch p.d {
-			case dup:
-				y--
-			case ddown:
-				y++
-			case dleft:
-				x--
-			case dright:
-				x++
-			}
-			if p.g.board[x][y] != blank {
-				clear = false
-				break
-			}
-		}
-		// when clear, mark player as alive
-		if clear {
-			p.dead = false
-			break
-		}
+	// eliminated players wait for the next round
+	if p.g.Mode == modeElimination && !p.g.warmup {
+		return
+	}
+	p.g.engine.place(&p.rider)
+}
+
+// setID gives the player a slot (and a colour) in the game
+func (p *Player) setID(id ID) {
+	p.id = id
+	// default name using id
+	if p.Name == "" {
+		p.Name = fmt.Sprintf("player-%d", id)
 	}
+	p.cname = fmt.Sprintf("%s%s%s", p.colourCode(), p.Name, ansi.Set(ansi.Reset))
+	p.logf = log.New(os.Stdout, p.cname+" ", 0).Printf
 }
 
+// spawn places the player at s, alive
+func (p *Player) spawn(s spawn) {
+	p.g.engine.spawn(&p.rider, s)
+	p.waiting = false
+	p.killcam = nil
+}
+
+// colourCode is the player's chosen colour, otherwise their id's
+// colour, as used in the logs
+func (p *Player) colourCode() []byte {
+	name := p.Colour
+	if name == "" {
+		name = defaultColour(p.id)
+	}
+	return themes[0].colour(name).escape(depthBasic)
+}
+
+// play starts the player's connection goroutines, which
+// forward all input and resizes to the game loop
 func (p *Player) play() {
 	p.logf("connected")
 	p.conn.Set(ansi.Reset)
 	p.conn.CursorHide()
-	go p.resizeWatch()
-	go p.recieveActions()
-	// block until player disconnects
-	<-p.playing
-	p.logf("disconnected")
+	go p.resizeWatch(p.size)
+	go p.forwardActions()
 }
 
 func (p *Player) teardown() {
@@ -183,12 +199,26 @@ func (p *Player) teardown() {
 }
 
 func (p *Player) teardownMeta() {
+	// bots have no connection, though they may have a process
+	if p.ai != nil {
+		if c, ok := p.ai.(io.Closer); ok {
+			c.Close()
+		}
+		return
+	}
 	p.conn.CursorShow()
 	p.conn.EraseScreen()
 	p.conn.Goto(1, 1)
 	p.conn.Set(ansi.Reset)
+	if p.farewell != "" {
+		p.conn.Write([]byte(p.farewell))
+	}
 	p.conn.Close()
-	close(p.playing)
+	// unblock the connection reader until it sees the close
+	go func() {
+		for range p.actions {
+		}
+	}()
 }
 
 func (p *Player) status() string {
@@ -196,12 +226,29 @@ func (p *Player) status() string {
 		return "not ready"
 	} else if p.dead && p.waiting {
 		return fmt.Sprintf("dead %1.1f", (p.g.RespawnDelay - time.Since(p.tdeath)).Seconds())
+	} else if p.g.Mode == modeElimination && !p.g.warmup && !p.g.intermission() {
+		if p.dead {
+			return "eliminated"
+		}
+		return "alive"
 	} else if p.dead {
 		return "ready"
+	} else if !p.dead && (p.boost || p.energy < energyMax) {
+		return "boost " + p.meter()
+	} else if power := p.power(); power != "" {
+		return power
+	} else if p.g.Mode == modeTrail {
+		return fmt.Sprintf("trail %d", p.trail)
 	}
 	return "playing"
 }
 
+// meter shows the player's boost energy
+func (p *Player) meter() string {
+	n := p.energy * meterWidth / energyMax
+	return strings.Repeat("=", n) + strings.Repeat(" ", meterWidth-n)
+}
+
 func (p *Player) recieveActions() {
 	buff := make([]byte, 0xffff)
 	for {
@@ -209,69 +256,150 @@ func (p *Player) recieveActions() {
 		if err != nil {
 			break
 		}
-		b := buff[:n]
-		if b[0] == 3 {
-			break
-		}
-		// ignore actions until ready
-		if !p.ready {
+		if n == 0 {
 			continue
 		}
-		// parse up,down,left,right
-		d := byte(p.d)
-		if len(b) == 3 && b[0] == ansi.Esc && b[1] == 91 &&
-			b[2] >= byte(dup) && b[2] <= byte(dleft) &&
-			// while preventing player from moving into itself (odd<->even)
-			((d%2 == 0 && d-1 != b[2]) || ((d+1)%2 == 0 && d+1 != b[2])) {
-			p.nextd = Direction(b[2])
-			continue
+		if buff[0] == 3 {
+			break
 		}
-		// respawn!
-		if b[0] == 13 {
-			p.respawn()
-			continue
+		b := make([]byte, n)
+		copy(b, buff[:n])
+		p.actions <- b
+	}
+	close(p.actions)
+}
+
+// forwardActions sends all input to the game loop, until disconnected
+func (p *Player) forwardActions() {
+	for b := range p.actions {
+		p.g.inputs <- inputEvent{p, b}
+	}
+	p.g.leaves <- p
+}
+
+// action is called by the game loop with a chunk of player input
+func (p *Player) action(b []byte) {
+	// ignore actions until ready, spectators only watch
+	if !p.ready || p.queued {
+		return
+	}
+	if p.spectating {
+		// move around boards larger than the terminal
+		if len(b) == 3 && b[0] == ansi.Esc && b[1] == 91 {
+			p.pan(Direction(b[2]))
+		} else if b[0] == 'i' {
+			p.invert()
 		}
-		// p.logf("sent action %+v", b)
+		return
+	}
+	// parse up,down,left,right
+	d := byte(p.d)
+	if len(b) == 3 && b[0] == ansi.Esc && b[1] == 91 &&
+		b[2] >= byte(dup) && b[2] <= byte(dleft) &&
+		// while preventing player from moving into itself (odd<->even)
+		((d%2 == 0 && d-1 != b[2]) || ((d+1)%2 == 0 && d+1 != b[2])) {
+		p.nextd = Direction(b[2])
+		return
+	}
+	// respawn!
+	if b[0] == 13 {
+		p.respawn()
+		return
+	}
+	// boost on/off, terminals don't send key releases
+	if b[0] == ' ' {
+		p.boost = !p.boost
+		p.g.rec.add(event{Kind: eventBoost, ID: p.id, On: p.boost})
+		return
+	}
+	// light terminal on/off
+	if b[0] == 'i' {
+		p.invert()
+		return
+	}
+	// p.logf("sent action %+v", b)
+}
+
+// invert swaps the player between the dark and light themes,
+// redrawing their whole screen, and saves the choice
+func (p *Player) invert() {
+	p.Invert = !p.Invert
+	p.resetScreen()
+	// spectators have no scores loaded, so only save preferences
+	if p.spectating {
+		go p.g.db.savePrefs(p.hash, p.prefs())
+	} else {
+		p.g.save(p)
 	}
-	p.teardown()
 }
 
 var resizeTmpl = string(ansi.Goto(2, 5)) +
 	string(ansi.Set(ansi.White)) +
 	"Please resize your terminal to %dx%d (+%dx+%d)"
 
-func (p *Player) resizeWatch() {
+// resizeWatch sends all resizes to the game loop, starting
+// with the terminal size received before joining
+func (p *Player) resizeWatch(initial resize) {
+	if initial.width > 0 {
+		p.g.resizes <- resizeEvent{p, initial}
+	}
 	for r := range p.resizes {
-		p.w = int(r.width)
-		p.h = int(r.height)
-		// fits?
-		if p.w >= p.g.w && p.h >= p.g.h {
-			p.conn.EraseScreen()
-			p.resetScreen()
-			// send updates!
-			p.ready = true
-		} else {
-			// doesnt fit
-			p.conn.EraseScreen()
-			p.conn.Write([]byte(fmt.Sprintf(resizeTmpl, p.g.w, p.g.h,
-				int(math.Max(float64(p.g.w-p.w), 0)),
-				int(math.Max(float64(p.g.h-p.h), 0)))))
-			p.screenRunes = nil
-			p.ready = false
-		}
+		p.g.resizes <- resizeEvent{p, r}
+	}
+}
+
+// setSize is called by the game loop when the player's terminal changes size
+func (p *Player) setSize(r resize) {
+	p.w = int(r.width)
+	p.h = int(r.height)
+	// the kill-cam was cut to the old size
+	p.killcam = nil
+	// fits?
+	if p.fitView() {
+		p.conn.EraseScreen()
+		p.resetScreen()
+		// send updates!
+		p.ready = true
+	} else {
+		// doesnt fit
+		w, h := p.minSize()
+		p.conn.EraseScreen()
+		p.conn.Write([]byte(fmt.Sprintf(resizeTmpl, w, h,
+			int(math.Max(float64(w-p.w), 0)),
+			int(math.Max(float64(h-p.h), 0)))))
+		p.screenRunes = nil
+		p.ready = false
 	}
 }
 
 // every tick, based on player screen size - calculate, store and send screen deltas.
 func (p *Player) update() {
-	if !p.ready {
+	// bots have no screen
+	if !p.ready || p.ai != nil {
 		return
 	}
 	g := p.g
 	gb := g.board
+	gs := p.glyphs
+	// the window of the board, which follows the cycle
+	p.follow()
+	vw, vh := p.view.w, p.view.h
+	cw := vw - sidebarWidth // board width in runes
+	ww, _ := p.window()     // and in tiles
+	var kx, ky int
+	if p.killcam != nil {
+		kx, ky = p.killcam.window(ww, vh)
+	}
 	// score state
 	totalPlayers := len(g.score.allPlayersSorted)
-	maxLines := (g.h - 1) - 2         //height units - borders
+	teamLines := g.teamLines()
+	maxLines := (vh - 1) - 2 - teamLines //height units - borders - teams
+	// minimap along the bottom, when there's room for it
+	mapTop := vh
+	if g.minimap != nil && p.windowed() && maxLines-g.minimap.h-1 >= slotHeight {
+		mapTop = vh - 1 - g.minimap.h
+		maxLines -= g.minimap.h + 1
+	}
 	maxSlots := maxLines / slotHeight //each player needs 3 lines
 	halfSlots := maxSlots / 2
 	startIndex := p.index - halfSlots
@@ -279,16 +407,19 @@ func (p *Player) update() {
 		startIndex = 0
 	}
 	// center board (origin) with offset width and height
-	ow := (p.w - g.w) / 2
-	oh := (p.h - g.h) / 2
+	ow := (p.w - vw) / 2
+	oh := (p.h - vh) / 2
 	// store the last rendered for network optimisation
 	var lastw, lasth uint16
 	var r rune
 	var c ID
+	// current team line
+	var teamLine string
+	var teamID ID
 	// screen loop
 	var u []byte
-	for h := 0; h < g.h; h++ {
-		for tw := 0; tw < g.w; tw++ {
+	for h := 0; h < vh; h++ {
+		for tw := 0; tw < vw; tw++ {
 			// each iteration draws rune (r) and color (c)
 			// at terminal location: w x h
 			r = empty
@@ -298,13 +429,32 @@ func (p *Player) update() {
 			if tw < sidebarWidth {
 				// pick rune from sidebar
 				if tw == 0 {
-					r = filled
+					r = gs.filled
 				} else if h == 0 {
-					r = top
-				} else if h == g.h-1 {
-					r = bottom
+					r = gs.top
+				} else if h == vh-1 {
+					r = gs.bottom
+				} else if h >= mapTop {
+					if x := tw - 1; x < minimapWidth {
+						r, c = p.minimapRune(x, h-mapTop)
+					}
+				} else if h-1 < teamLines {
+					// team totals, then a gap
+					if i := h - 1; i < len(g.teams) {
+						if tw == 1 {
+							teamLine = g.teamScore(g.teams[i])
+							teamID = blank
+							if m := g.teamMember(g.teams[i]); m != nil {
+								teamID = m.id
+							}
+						}
+						if tw-1 < len(teamLine) {
+							r = rune(teamLine[tw-1])
+							c = teamID
+						}
+					}
 				} else {
-					bh := h - 1 //borderless height
+					bh := h - 1 - teamLines //borderless height
 					playerSlot := bh / slotHeight
 					playerIndex := startIndex + playerSlot
 					if playerIndex < totalPlayers {
@@ -313,13 +463,25 @@ func (p *Player) update() {
 						if tw == 1 {
 							switch line {
 							case 0:
-								sp.score[0] = fmt.Sprintf("%s            ", sp.Name)
+								if sp.ai != nil {
+									sp.score[0] = fmt.Sprintf("%s [bot]       ", sp.Name)
+								} else {
+									sp.score[0] = fmt.Sprintf("%s            ", sp.Name)
+								}
 							case 1:
 								sp.score[1] = fmt.Sprintf("  rank  #%03d  ", sp.rank)
 							case 2:
 								sp.score[2] = fmt.Sprintf("  %s           ", sp.status())
 							case 3:
-								sp.score[3] = fmt.Sprintf("  kills %4d   ", sp.Kills)
+								if g.Mode == modeElimination {
+									sp.score[3] = fmt.Sprintf("  wins  %4d   ", sp.Wins)
+								} else if g.Mode == modeTrail {
+									sp.score[3] = fmt.Sprintf("  best  %4d   ", sp.Best)
+								} else if g.KillLimit > 0 {
+									sp.score[3] = fmt.Sprintf("  kills %2d/%-3d", sp.roundKills, g.KillLimit)
+								} else {
+									sp.score[3] = fmt.Sprintf("  kills %4d   ", sp.Kills)
+								}
 							}
 						}
 						if tw-1 < len(sp.score[line]) {
@@ -329,23 +491,30 @@ func (p *Player) update() {
 					}
 				}
 			} else {
-				// pick rune from game board, one rune is two game tiles
-				gw := tw - sidebarWidth
-				h1 := h * 2
-				h2 := h1 + 1
-				// choose rune
-				if gb[gw][h1] != blank && gb[gw][h2] != blank {
-					r = filled
-				} else if gb[gw][h1] != blank {
-					r = top
-				} else if gb[gw][h2] != blank {
-					r = bottom
-				}
-				// choose color (use color of h1, otherwise h2)
-				if gb[gw][h2] == blank {
-					c = gb[gw][h1]
+				// pick rune from game board, glyph sets draw
+				// one or two tiles per rune, or two runes per tile
+				vx := tw - sidebarWidth
+				x := vx / gs.cols
+				if x >= ww {
+					// the rest of a tile, at the edge of the window
+				} else if p.killcam != nil {
+					// kill-cam has one tile per rune
+					r, c = p.killcam.tile(gs, x+kx, h+ky)
 				} else {
-					c = gb[gw][h2]
+					r, c = gs.tile(gb, x+p.view.ox, (h+p.view.oy)*gs.rows)
+				}
+				// round banner (or this player's overlay) covers the board
+				if br, ok := g.overlayRune(g.banner, vx, h, cw, vh); ok {
+					r = br
+					c = g.bannerColour()
+				} else if or, ok := g.overlayRune(p.overlay, vx, h, cw, vh); ok {
+					r = or
+					c = blank
+				} else if p.killcam != nil && h == 0 {
+					if cr, ok := p.killcam.captionRune(vx, cw); ok {
+						r = cr
+						c = blank
+					}
 				}
 			}
 			// player board is different? draw it
@@ -361,7 +530,7 @@ func (p *Player) update() {
 				}
 				// p.logf("draw [%d,%d] '%s' (%d)", nexth, nextw, string(r), c)
 				// write color
-				u = append(u, colours[c]...)
+				u = append(u, p.paint(c)...)
 				p.screenColors[tw][h] = c
 				// write rune
 				u = append(u, []byte(string(r))...)
@@ -0,0 +1,123 @@
+package tron
+
+// power-ups are board tiles, collected by riding into them
+const (
+	itemSpeed  = ID(0xfff0) // moves two tiles per tick
+	itemGhost  = ID(0xfff1) // rides through trails
+	itemBomb   = ID(0xfff2) // erases the trails around it
+	itemShield = ID(0xfff3) // survives one crash
+)
+
+const (
+	powerTicks = 60 // ticks a speed or ghost power-up lasts
+	bombRadius = 6  // tiles erased around a bomb
+	dropChance = 50 // chance of a power-up each tick is 1 in N
+)
+
+// item is how a power-up is drawn
+type item struct {
+	name   string
+	glyph  rune
+	ascii  rune   // glyph for terminals without unicode
+	colour string // brighter than a player's colour
+}
+
+var items = map[ID]item{
+	itemSpeed:  {"speed", '»', '>', "yellow"},
+	itemGhost:  {"ghost", '~', '~', "cyan"},
+	itemBomb:   {"bomb", '*', '*', "red"},
+	itemShield: {"shield", '+', '+', "green"},
+}
+
+// dropped in order, chosen at random
+var itemKinds = []ID{itemSpeed, itemGhost, itemBomb, itemShield}
+
+func isItem(id ID) bool {
+	return id >= itemSpeed && id <= itemShield
+}
+
+// itemAt returns the power-up, if any, in either of the two tiles
+// drawn by a single rune
+func itemAt(a, b ID) (ID, bool) {
+	if isItem(a) {
+		return a, true
+	}
+	if isItem(b) {
+		return b, true
+	}
+	return blank, false
+}
+
+// maxItems is the most power-ups on the board at once
+func (e *engine) maxItems() int {
+	return 1 + e.w*e.h/1000
+}
+
+// drop may place a random power-up on an empty tile
+func (e *engine) drop() {
+	if e.items >= e.maxItems() || e.rand.Intn(dropChance) > 0 {
+		return
+	}
+	id := itemKinds[e.rand.Intn(len(itemKinds))]
+	for i := 0; i < respawnAttempts; i++ {
+		x := e.rand.Intn(e.w-2) + 1
+		y := e.rand.Intn(e.h-2) + 1
+		if e.board[x][y] == blank {
+			e.put(x, y, id)
+			return
+		}
+	}
+}
+
+// put places a power-up on the board
+func (e *engine) put(x, y int, id ID) {
+	e.board[x][y] = id
+	e.items++
+	e.rec.add(event{Kind: eventItem, ID: id, X: x, Y: y})
+}
+
+// collect gives the rider the power-up it rode into
+func (e *engine) collect(r *rider, id ID) {
+	e.board[r.x][r.y] = blank
+	e.items--
+	switch id {
+	case itemSpeed:
+		r.fast = powerTicks
+	case itemGhost:
+		r.ghost = powerTicks
+	case itemShield:
+		r.shield = true
+	case itemBomb:
+		x0, y0 := r.x, r.y
+		for dx := -bombRadius; dx <= bombRadius; dx++ {
+			for dy := -bombRadius; dy <= bombRadius; dy++ {
+				if dx*dx+dy*dy > bombRadius*bombRadius {
+					continue
+				}
+				x, y := x0+dx, y0+dy
+				if e.wrap {
+					x, y = (x+e.w)%e.w, (y+e.h)%e.h
+				}
+				if x < 0 || y < 0 || x >= e.w || y >= e.h {
+					continue
+				}
+				if id := e.board[x][y]; id != wall && !isItem(id) {
+					e.board[x][y] = blank
+				}
+			}
+		}
+	}
+}
+
+// power is the rider's strongest power-up, shown in the sidebar
+func (r *rider) power() string {
+	switch {
+	case r.fast > 0:
+		return items[itemSpeed].name
+	case r.ghost > 0:
+		return items[itemGhost].name
+	case r.shield:
+		return items[itemShield].name
+	}
+	return ""
+}
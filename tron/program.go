@@ -0,0 +1,268 @@
+package tron
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// longest bot program name shown in the sidebar
+const programNameLength = 8
+
+// extra time given for a bot program's first reply, while it starts
+// up, which is a warm up before the game loop starts
+var programStartup = time.Second
+
+// fallible is a Strategy which may fail, such as a bot
+// program. failed bots are disqualified from the game.
+type fallible interface {
+	failed() error
+}
+
+// thinker is a Strategy which is asked for its move before Steer
+// is called, such as a bot program. the game loop asks every
+// thinker first, so they all think at once, by one deadline.
+type thinker interface {
+	ask(s *Snapshot, deadline time.Time)
+}
+
+// program is a Strategy run as a subprocess. Each tick it's
+// sent the game on stdin and must reply with a direction on
+// stdout, within the time limit.
+type program struct {
+	cmd      *exec.Cmd
+	timeout  time.Duration
+	requests chan []byte
+	replies  chan string
+	done     chan struct{}
+	deadline time.Time // for the last request, zero once answered
+	err      error
+}
+
+func newProgram(command string, timeout time.Duration) (*program, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("missing command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	pr := &program{
+		cmd:      cmd,
+		timeout:  timeout,
+		requests: make(chan []byte, 1),
+		replies:  make(chan string),
+		done:     make(chan struct{}),
+	}
+	go pr.write(stdin)
+	go pr.read(stdout)
+	return pr, nil
+}
+
+// write sends requests to the program, until closed
+func (pr *program) write(stdin io.WriteCloser) {
+	for b := range pr.requests {
+		if _, err := stdin.Write(b); err != nil {
+			break
+		}
+	}
+	stdin.Close()
+}
+
+// read forwards each line from the program, until it exits
+func (pr *program) read(stdout io.Reader) {
+	s := bufio.NewScanner(stdout)
+	for s.Scan() {
+		select {
+		case pr.replies <- s.Text():
+		case <-pr.done:
+			return
+		}
+	}
+	close(pr.replies)
+}
+
+// ask sends the snapshot to the program, which has until the
+// deadline to reply
+func (pr *program) ask(s *Snapshot, deadline time.Time) {
+	select {
+	case pr.requests <- encode(s):
+		pr.deadline = deadline
+	default:
+		pr.err = errors.New("not reading its input")
+	}
+}
+
+// Steer waits for the reply to the snapshot, asking for it
+// first unless the game loop already has
+func (pr *program) Steer(s *Snapshot) Direction {
+	if pr.err == nil && pr.deadline.IsZero() {
+		pr.ask(s, time.Now().Add(pr.timeout))
+	}
+	if pr.err != nil {
+		return s.Self.Direction
+	}
+	t := time.NewTimer(time.Until(pr.deadline))
+	defer t.Stop()
+	pr.deadline = time.Time{}
+	select {
+	case line, ok := <-pr.replies:
+		if !ok {
+			pr.err = errors.New("exited")
+			break
+		}
+		d, err := parseDirection(line)
+		if err != nil {
+			pr.err = err
+			break
+		}
+		return d
+	case <-t.C:
+		pr.err = fmt.Errorf("no move within %s", pr.timeout)
+	}
+	return s.Self.Direction
+}
+
+func (pr *program) failed() error {
+	return pr.err
+}
+
+// Close stops the program, called on teardown
+func (pr *program) Close() error {
+	close(pr.done)
+	close(pr.requests)
+	err := pr.cmd.Process.Kill()
+	go pr.cmd.Wait()
+	return err
+}
+
+// encode writes the snapshot in the bot program protocol:
+//
+//	board <width> <height> [wrap]
+//	<height rows of width tiles, '.' is empty and '#' is blocked>
+//	cycle <id> <x> <y> <direction> <alive|dead> <self|teammate|opponent>
+//	...
+//	end
+func encode(s *Snapshot) []byte {
+	var b bytes.Buffer
+	if s.Wrap {
+		fmt.Fprintf(&b, "board %d %d wrap\n", s.Width, s.Height)
+	} else {
+		fmt.Fprintf(&b, "board %d %d\n", s.Width, s.Height)
+	}
+	row := make([]byte, s.Width+1)
+	row[s.Width] = '\n'
+	for y := 0; y < s.Height; y++ {
+		for x := 0; x < s.Width; x++ {
+			if s.Free(x, y) {
+				row[x] = '.'
+			} else {
+				row[x] = '#'
+			}
+		}
+		b.Write(row)
+	}
+	cycle := func(c Cycle, who string) {
+		state := "dead"
+		if c.Alive {
+			state = "alive"
+		}
+		fmt.Fprintf(&b, "cycle %d %d %d %s %s %s\n", c.ID, c.X, c.Y, c.Direction, state, who)
+	}
+	cycle(s.Self, "self")
+	for _, c := range s.Opponents {
+		if c.Teammate {
+			cycle(c, "teammate")
+		} else {
+			cycle(c, "opponent")
+		}
+	}
+	b.WriteString("end\n")
+	return b.Bytes()
+}
+
+// parseDirection reads a bot program's reply
+func parseDirection(line string) (Direction, error) {
+	line = strings.ToLower(strings.TrimSpace(line))
+	for _, d := range directions {
+		if line == d.String() {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid move %q", line)
+}
+
+// startPrograms runs each of the configured bot programs as a player
+func (g *Game) startPrograms() {
+	programs := []*Player{}
+	for _, command := range strings.Split(g.BotPrograms, ",") {
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		if len(g.idPool) == 0 {
+			g.logf("no slot left for bot program: %s", command)
+			break
+		}
+		id := <-g.idPool
+		pr, err := newProgram(command, g.BotTimeout)
+		if err != nil {
+			g.idPool <- id
+			g.logf("bot program %s failed to start: %s", command, err)
+			continue
+		}
+		name := filepath.Base(strings.Fields(command)[0])
+		if len(name) > programNameLength {
+			name = name[:programNameLength]
+		}
+		p := newRobot(pr, fmt.Sprintf("%s-%d", name, id))
+		g.enter(p, id)
+		p.logf("bot program started: %s", command)
+		programs = append(programs, p)
+	}
+	g.warmUp(programs)
+}
+
+// warmUp sends each bot program a first snapshot, before the game
+// loop starts, and waits for them all to reply, so that no one
+// waits for the programs to start up during the game
+func (g *Game) warmUp(programs []*Player) {
+	riders := g.riders()
+	deadline := time.Now().Add(g.BotTimeout + programStartup)
+	snapshots := make([]*Snapshot, len(programs))
+	for i, p := range programs {
+		snapshots[i] = g.engine.snapshot(&p.rider, riders)
+		p.ai.(*program).ask(snapshots[i], deadline)
+	}
+	for i, p := range programs {
+		pr := p.ai.(*program)
+		pr.Steer(snapshots[i])
+		if err := pr.failed(); err != nil {
+			g.disqualify(p, fmt.Errorf("starting up: %s", err))
+		}
+	}
+}
+
+// disqualify removes a failed bot from the game for good
+func (g *Game) disqualify(p *Player, err error) {
+	p.logf("disqualified (%s)", err)
+	g.announce(fmt.Sprintf("bot *%s* was disqualified (%s)", p.Name, err))
+	g.leave(p)
+}
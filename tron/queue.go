@@ -0,0 +1,82 @@
+package tron
+
+import (
+	"fmt"
+	"time"
+)
+
+// number of recent departures used to estimate queue wait times
+const queueSamples = 5
+
+// enqueue holds a player until an id is free, they
+// watch the game (as a spectator) while they wait
+func (g *Game) enqueue(p *Player) {
+	p.queued = true
+	g.queue = append(g.queue, p)
+	p.logf("queued (#%d)", len(g.queue))
+}
+
+// dequeue removes a player from the queue, reporting whether it was queued
+func (g *Game) dequeue(p *Player) bool {
+	for i, q := range g.queue {
+		if q == p {
+			g.queue = append(g.queue[:i], g.queue[i+1:]...)
+			p.queued = false
+			return true
+		}
+	}
+	return false
+}
+
+// inQueue reports whether a player with this hash is already waiting
+func (g *Game) inQueue(hash string) bool {
+	for _, q := range g.queue {
+		if q.hash == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// promote moves queued players into the game while there are free ids
+func (g *Game) promote() {
+	for len(g.queue) > 0 {
+		select {
+		case id := <-g.idPool:
+			p := g.queue[0]
+			g.dequeue(p)
+			g.admit(p, id)
+			p.overlay = nil
+			p.logf("promoted from the queue")
+		default:
+			return
+		}
+	}
+}
+
+// departed records when an id was returned, for the wait estimate
+func (g *Game) departed() {
+	g.departures = append(g.departures, time.Now())
+	if len(g.departures) > queueSamples {
+		g.departures = g.departures[1:]
+	}
+}
+
+// renderQueue prepares each queued player's position and wait estimate
+func (g *Game) renderQueue() {
+	// average time between departures
+	var gap time.Duration
+	if n := len(g.departures); n >= 2 {
+		gap = g.departures[n-1].Sub(g.departures[0]) / time.Duration(n-1)
+	}
+	for i, p := range g.queue {
+		eta := "unknown"
+		if gap > 0 {
+			eta = (time.Duration(i+1) * gap).Round(time.Second).String()
+		}
+		p.overlay = []string{
+			fmt.Sprintf(" game full, you are #%d in queue ", i+1),
+			fmt.Sprintf(" estimated wait %s ", eta),
+		}
+	}
+}
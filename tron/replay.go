@@ -0,0 +1,552 @@
+package tron
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	replayVersion = 1
+	replayExt     = ".replay"
+	replayList    = 20 // replays listed by the lobby
+)
+
+// longest recording, rounds are split after this long
+var recordLength = 5 * time.Minute
+
+var replayName = regexp.MustCompile(`^[\w-]+$`)
+
+// replay is a recorded round, stored as gzipped JSON. It holds the
+// state at the start of the recording, then every event which
+// changed the board, tick by tick. The engine replays the moves.
+type replay struct {
+	Version   int           `json:"version"`
+	Arena     string        `json:"arena"`
+	Round     int           `json:"round"`
+	Mode      string        `json:"mode"`
+	KillLimit int           `json:"killLimit,omitempty"`
+	Width     int           `json:"width"`
+	Height    int           `json:"height"`
+	Wrap      bool          `json:"wrap,omitempty"`
+	Players   int           `json:"players"`
+	Speed     time.Duration `json:"speed"`
+	Recorded  time.Time     `json:"recorded"`
+	Ticks     int           `json:"ticks"`
+	Board     Board         `json:"board"`
+	Riders    []replayRider `json:"riders"`
+	Events    []event       `json:"events"`
+}
+
+// replayRider is a player at the start of a recording
+type replayRider struct {
+	ID     ID        `json:"i"`
+	Name   string    `json:"n"`
+	Colour string    `json:"c"`
+	X      int       `json:"x"`
+	Y      int       `json:"y"`
+	D      Direction `json:"d"`
+	Dead   bool      `json:"dead,omitempty"`
+	Trail  int       `json:"trail,omitempty"`
+	Kills  int       `json:"kills,omitempty"`
+	Deaths int       `json:"deaths,omitempty"`
+	Fast   int       `json:"fast,omitempty"`
+	Ghost  int       `json:"ghost,omitempty"`
+	Shield bool      `json:"shield,omitempty"`
+	Boost  bool      `json:"boost,omitempty"`
+	Energy int       `json:"energy"`
+}
+
+// kinds of recorded event
+const (
+	eventJoin  = "join"  // a player (name and colour) took an id
+	eventLeave = "leave" // the id was freed
+	eventSpawn = "spawn" // a rider came alive at (x, y) heading d
+	eventSteer = "steer" // a rider's next direction changed to d
+	eventStep  = "step"  // the engine moved every rider
+	eventDeath = "death" // a rider crashed, into the killer's trail
+	eventClear = "clear" // a rider's trail was removed
+	eventReset = "reset" // all trails were removed, and all riders
+	eventItem  = "item"  // a power-up (id) was dropped at (x, y)
+	eventBoost = "boost" // a rider started or stopped boosting
+)
+
+// event is a change to the game during a tick
+type event struct {
+	Tick   int       `json:"t"`
+	Kind   string    `json:"k"`
+	ID     ID        `json:"i,omitempty"`
+	X      int       `json:"x,omitempty"`
+	Y      int       `json:"y,omitempty"`
+	D      Direction `json:"d,omitempty"`
+	Killer ID        `json:"by,omitempty"`
+	Name   string    `json:"n,omitempty"`
+	Colour string    `json:"c,omitempty"`
+	On     bool      `json:"on,omitempty"`
+}
+
+// recording is the replay being recorded by the game loop
+type recording struct {
+	*replay
+	started time.Time
+	moves   int // rider moves, empty recordings are discarded
+}
+
+// add appends the event at the current tick, a nil recording is ignored
+func (r *recording) add(e event) {
+	if r == nil {
+		return
+	}
+	e.Tick = r.Ticks
+	r.Events = append(r.Events, e)
+}
+
+// step records the riders' turns, ahead of an engine step
+func (r *recording) step(riders []*rider) {
+	if r == nil {
+		return
+	}
+	for _, rd := range riders {
+		if rd.dead {
+			continue
+		}
+		if rd.nextd != rd.d {
+			r.add(event{Kind: eventSteer, ID: rd.id, D: rd.nextd})
+		}
+		r.moves++
+	}
+	r.add(event{Kind: eventStep})
+}
+
+// startRecording starts a new replay of the game as it is now
+func (g *Game) startRecording() {
+	if g.RecordDir == "" {
+		return
+	}
+	r := &recording{
+		replay: &replay{
+			Version:   replayVersion,
+			Arena:     g.name,
+			Round:     g.round,
+			Mode:      g.Mode,
+			KillLimit: g.KillLimit,
+			Width:     g.bw,
+			Height:    g.bh,
+			Wrap:      g.engine.wrap,
+			Players:   g.MaxPlayers,
+			Speed:     g.GameSpeed,
+			Board:     make(Board, g.bw),
+		},
+		started: time.Now(),
+	}
+	for w := range g.board {
+		r.Board[w] = append([]ID(nil), g.board[w]...)
+	}
+	for _, rd := range g.riders() {
+		p := g.currPlayers[rd.id]
+		r.Riders = append(r.Riders, replayRider{
+			ID:     p.id,
+			Name:   p.Name,
+			Colour: g.colourName(p.id),
+			X:      p.x,
+			Y:      p.y,
+			D:      p.d,
+			Dead:   p.dead,
+			Trail:  p.trail,
+			Kills:  p.Kills,
+			Deaths: p.Deaths,
+			Fast:   p.fast,
+			Ghost:  p.ghost,
+			Shield: p.shield,
+			Boost:  p.boost,
+			Energy: p.energy,
+		})
+	}
+	g.rec = r
+	g.engine.rec = r
+}
+
+// stopRecording saves the current replay, unless nothing happened
+func (g *Game) stopRecording() {
+	r := g.rec
+	if r == nil {
+		return
+	}
+	g.rec = nil
+	g.engine.rec = nil
+	if r.moves == 0 {
+		return
+	}
+	r.Recorded = time.Now()
+	name := fmt.Sprintf("%s-%s", g.name, r.started.Format("20060102-150405"))
+	go func() {
+		name, err := saveReplay(g.RecordDir, name, r.replay)
+		if err != nil {
+			g.logf("failed to save replay: %s", err)
+			return
+		}
+		g.logf("saved replay %s", name)
+	}()
+}
+
+// recordTick moves the recording on to the next tick, splitting
+// long recordings. called by the game loop.
+func (g *Game) recordTick() {
+	if g.rec == nil {
+		return
+	}
+	if time.Since(g.rec.started) >= recordLength {
+		g.stopRecording()
+		g.startRecording()
+	}
+	g.rec.Ticks++
+}
+
+// saveReplay saves the replay in the directory under the given
+// name, numbering it when rounds end in the same second, and
+// returns the name it was saved under
+func saveReplay(dir, name string, r *replay) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	var f *os.File
+	var err error
+	for n := 1; ; n++ {
+		saved := name
+		if n > 1 {
+			saved = fmt.Sprintf("%s-%d", name, n)
+		}
+		f, err = os.OpenFile(filepath.Join(dir, saved+replayExt), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		name = saved
+		break
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	z := gzip.NewWriter(f)
+	if err := json.NewEncoder(z).Encode(r); err != nil {
+		return "", err
+	}
+	return name, z.Close()
+}
+
+func loadReplay(path string) (*replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	z, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	r := &replay{}
+	if err := json.NewDecoder(z).Decode(r); err != nil {
+		return nil, err
+	}
+	if r.Version != replayVersion {
+		return nil, fmt.Errorf("unsupported replay version %d", r.Version)
+	}
+	return r, nil
+}
+
+// replays lists the most recent replays
+func (l *Lobby) replays() string {
+	if l.RecordDir == "" {
+		return "Replays are not recorded on this server\r\n"
+	}
+	files, err := ioutil.ReadDir(l.RecordDir)
+	if err != nil {
+		return "No replays\r\n"
+	}
+	names := []string{}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), replayExt) {
+			names = append(names, strings.TrimSuffix(f.Name(), replayExt))
+		}
+	}
+	if len(names) == 0 {
+		return "No replays\r\n"
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	if len(names) > replayList {
+		names = names[:replayList]
+	}
+	return "Watch a replay with: ssh <host> replay <name>\r\n\r\n" +
+		strings.Join(names, "\r\n") + "\r\n"
+}
+
+// replay starts a private game which plays back the named
+// replay, for the player to watch
+func (l *Lobby) replay(name string) (*Game, error) {
+	if l.RecordDir == "" || !replayName.MatchString(name) {
+		return nil, errors.New("no such replay")
+	}
+	r, err := loadReplay(filepath.Join(l.RecordDir, name+replayExt))
+	if err != nil {
+		return nil, err
+	}
+	c := l.Config
+	c.Width, c.Height = r.Width, r.Height
+	c.MaxPlayers = r.Players
+	c.Mode = r.Mode
+	c.KillLimit = r.KillLimit
+	c.GameSpeed = r.Speed
+	c.Teams = 0
+	c.ResetOnDeath = false
+	c.Bots = 0
+	c.BotPrograms = ""
+	c.RecordDir = ""
+	c.Map = ""
+	c.Wrap = false
+	c.PowerUps = false
+	c.KillCam = false
+	g, err := newGame("replay", c, l)
+	if err != nil {
+		return nil, err
+	}
+	g.warmup = false
+	g.engine.wrap = r.Wrap
+	go g.playback(r)
+	return g, nil
+}
+
+// playback speeds, as a multiple of the recorded game speed
+var playbackSpeeds = []float64{0.25, 0.5, 1, 2, 4, 8}
+
+// playback is the state of a replay being watched
+type playback struct {
+	g       *Game
+	r       *replay
+	tick    int // next tick to play
+	event   int // next event to play
+	paused  bool
+	speed   int       // index into playbackSpeeds
+	changed time.Time // last change of speed
+}
+
+// playback is the game loop of a replay. it plays the recorded events
+// instead of player input, until the last viewer leaves.
+func (g *Game) playback(r *replay) {
+	pb := &playback{g: g, r: r, speed: 2}
+	pb.restart()
+	ticker := time.NewTicker(g.GameSpeed)
+	defer ticker.Stop()
+	g.logf("playing %s round %d (%d ticks)", r.Arena, r.Round, r.Ticks)
+	for {
+		select {
+		case p := <-g.joins:
+			g.join(p)
+		case p := <-g.leaves:
+			g.leave(p)
+			if len(g.spectators) == 0 {
+				close(g.done)
+				return
+			}
+		case e := <-g.inputs:
+			if !g.connected(e.p) {
+				continue
+			}
+			if e.b[0] == 'i' {
+				e.p.invert()
+			} else if pb.control(e.b) {
+				ticker.Reset(pb.interval())
+			}
+		case e := <-g.resizes:
+			if g.connected(e.p) {
+				e.p.setSize(e.r)
+			}
+		case <-ticker.C:
+			if !pb.paused {
+				pb.advance()
+			}
+			pb.render()
+		case <-g.quit:
+			g.shutdown()
+			return
+		}
+	}
+}
+
+// restart puts the board and players back to the start of the replay
+func (pb *playback) restart() {
+	g, r := pb.g, pb.r
+	g.engine.items = 0
+	for w := range g.board {
+		copy(g.board[w], r.Board[w])
+		for _, id := range g.board[w] {
+			if isItem(id) {
+				g.engine.items++
+			}
+		}
+	}
+	g.allPlayers = map[string]*Player{}
+	g.currPlayers = map[ID]*Player{}
+	for _, rr := range r.Riders {
+		p := pb.join(rr.ID, rr.Name, rr.Colour)
+		p.x, p.y, p.d, p.nextd = rr.X, rr.Y, rr.D, rr.D
+		p.dead = rr.Dead
+		p.trail = rr.Trail
+		p.Kills = rr.Kills
+		p.Deaths = rr.Deaths
+		p.fast, p.ghost, p.shield = rr.Fast, rr.Ghost, rr.Shield
+		p.boost, p.energy = rr.Boost, rr.Energy
+	}
+	g.score.compute()
+	pb.tick, pb.event = 0, 0
+	pb.paused = false
+}
+
+// join adds a recorded player
+func (pb *playback) join(id ID, name, colour string) *Player {
+	p := NewPlayer(id, name, name, fmt.Sprintf("replay/%d/%s", id, name), nil)
+	p.g = pb.g
+	p.ready = true
+	// older replays recorded escape codes
+	if knownColour(colour) {
+		p.Colour = colour
+	}
+	pb.g.allPlayers[p.hash] = p
+	pb.g.currPlayers[id] = p
+	return p
+}
+
+// advance plays the events of the next tick
+func (pb *playback) advance() {
+	g, r := pb.g, pb.r
+	if pb.tick > r.Ticks {
+		pb.paused = true
+		return
+	}
+	for ; pb.event < len(r.Events) && r.Events[pb.event].Tick <= pb.tick; pb.event++ {
+		e := r.Events[pb.event]
+		p := g.currPlayers[e.ID]
+		switch e.Kind {
+		case eventJoin:
+			pb.join(e.ID, e.Name, e.Colour)
+			g.score.compute()
+		case eventLeave:
+			if p != nil {
+				delete(g.allPlayers, p.hash)
+				delete(g.currPlayers, e.ID)
+				g.score.compute()
+			}
+		case eventSpawn:
+			if p != nil {
+				p.spawn(spawn{e.X, e.Y, e.D})
+			}
+		case eventSteer:
+			if p != nil {
+				p.nextd = e.D
+			}
+		case eventStep:
+			g.engine.step(g.riders())
+		case eventDeath:
+			if p != nil {
+				p.Deaths++
+			}
+			if k, ok := g.currPlayers[e.Killer]; ok {
+				k.Kills++
+				k.roundKills++
+			}
+			g.score.compute()
+		case eventClear:
+			g.engine.clear(e.ID)
+		case eventReset:
+			g.engine.reset()
+			for _, p := range g.currPlayers {
+				p.dead = true
+			}
+		case eventItem:
+			g.engine.put(e.X, e.Y, e.ID)
+		case eventBoost:
+			if p != nil {
+				p.boost = e.On
+			}
+		}
+	}
+	pb.tick++
+}
+
+// control handles a viewer's key press, reporting
+// whether the playback speed changed
+func (pb *playback) control(b []byte) bool {
+	if len(b) == 3 && b[0] == 27 && b[1] == 91 {
+		switch Direction(b[2]) {
+		case dright:
+			// step one tick at a time
+			pb.paused = true
+			pb.advance()
+		case dup:
+			return pb.faster(1)
+		case ddown:
+			return pb.faster(-1)
+		}
+		return false
+	}
+	switch b[0] {
+	case ' ':
+		pb.paused = !pb.paused
+		if pb.tick > pb.r.Ticks {
+			pb.restart()
+		}
+	case 'r':
+		pb.restart()
+	case '+':
+		return pb.faster(1)
+	case '-':
+		return pb.faster(-1)
+	}
+	return false
+}
+
+// faster changes the speed by n steps, reporting whether it changed
+func (pb *playback) faster(n int) bool {
+	s := pb.speed + n
+	if s < 0 || s >= len(playbackSpeeds) {
+		return false
+	}
+	pb.speed = s
+	pb.changed = time.Now()
+	return true
+}
+
+// interval is the time between ticks at the current speed
+func (pb *playback) interval() time.Duration {
+	return time.Duration(float64(pb.r.Speed) / playbackSpeeds[pb.speed])
+}
+
+// render draws the playback state over the board, then updates viewers
+func (pb *playback) render() {
+	var overlay []string
+	if pb.tick > pb.r.Ticks {
+		overlay = []string{" END OF REPLAY ", "", " space or r to restart "}
+	} else if pb.paused {
+		overlay = []string{
+			fmt.Sprintf(" PAUSED %d/%d ", pb.tick, pb.r.Ticks),
+			"",
+			" space play, right step, r restart ",
+		}
+	} else if time.Since(pb.changed) < time.Second {
+		overlay = []string{fmt.Sprintf(" speed x%g ", playbackSpeeds[pb.speed])}
+	}
+	for p := range pb.g.spectators {
+		if p.ready {
+			p.overlay = overlay
+			p.update()
+		}
+	}
+	pb.g.score.changed = false
+}
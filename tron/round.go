@@ -0,0 +1,281 @@
+package tron
+
+import (
+	"fmt"
+	"time"
+)
+
+// time between the end of one round and the start of the next
+var roundDelay = 5 * time.Second
+
+// roundResult is stored in the database at the end of each round
+type roundResult struct {
+	Arena  string         `json:"arena"`
+	Round  int            `json:"round"`
+	Mode   string         `json:"mode"`
+	Ended  time.Time      `json:"ended"`
+	Winner string         `json:"winner"`
+	Kills  map[string]int `json:"kills"`
+	Team   string         `json:"team,omitempty"`
+	Teams  map[string]int `json:"teams,omitempty"`
+}
+
+// intermission reports whether the game is between rounds
+func (g *Game) intermission() bool {
+	return !g.roundEnd.IsZero()
+}
+
+// checkRound ends the round once the mode's win condition is met.
+// called by the game loop after each move.
+func (g *Game) checkRound() {
+	switch g.Mode {
+	case modeKills:
+		// someone reached the kill limit
+		if g.winner != nil || g.winnerTeam != nil {
+			g.endRound()
+		}
+	case modeElimination:
+		alive, ready := 0, 0
+		var survivor *Player
+		aliveTeams, readyTeams := map[*team]bool{}, map[*team]bool{}
+		for _, p := range g.currPlayers {
+			if p.ready {
+				ready++
+				readyTeams[p.team] = true
+			}
+			if !p.dead {
+				alive++
+				aliveTeams[p.team] = true
+				survivor = p
+			}
+		}
+		if g.teams != nil {
+			// teams play as one
+			ready, alive = len(readyTeams), len(aliveTeams)
+		}
+		if g.warmup {
+			// enough players to start a real round
+			if ready >= 2 {
+				g.countdown()
+			}
+		} else if alive <= 1 {
+			// last cycle (or team) standing, or a draw
+			if g.teams != nil && survivor != nil {
+				g.winnerTeam = survivor.team
+			} else {
+				g.winner = survivor
+			}
+			g.endRound()
+		}
+	}
+}
+
+// endRound freezes the game, announces the winner and
+// records the result. called by the game loop.
+func (g *Game) endRound() {
+	w := g.winner
+	r := &roundResult{
+		Arena: g.name,
+		Round: g.round,
+		Mode:  g.Mode,
+		Ended: time.Now(),
+		Kills: map[string]int{},
+	}
+	for _, p := range g.currPlayers {
+		r.Kills[p.SSHName] = p.roundKills
+	}
+	if g.teams != nil {
+		r.Teams = map[string]int{}
+		for _, t := range g.teams {
+			r.Teams[t.name] = t.kills
+		}
+	}
+	if t := g.winnerTeam; t != nil {
+		r.Team = t.name
+		t.wins++
+		for _, p := range g.currPlayers {
+			if p.team == t {
+				p.Wins++
+				g.save(p)
+			}
+		}
+		g.score.compute()
+		g.logf("round %d won by team %s", g.round, t.name)
+		g.announce(fmt.Sprintf("team *%s* won round %d", t.name, g.round))
+	} else if w != nil {
+		r.Winner = w.SSHName
+		w.Wins++
+		g.score.compute()
+		g.save(w)
+		g.logf("round %d won by %s", g.round, w.Name)
+		g.announce(fmt.Sprintf("*%s* won round %d", w.SSHName, g.round))
+	} else {
+		g.logf("round %d was a draw", g.round)
+	}
+	g.db.saveRound(r)
+	g.result = r
+	g.round++
+	g.countdown()
+}
+
+// countdown clears the board and waits for the next round
+func (g *Game) countdown() {
+	g.roundEnd = time.Now()
+	for _, p := range g.currPlayers {
+		// take everyone off the board, without counting a death
+		g.survived(p)
+		p.dead = true
+		p.waiting = false
+		p.cleared = true
+	}
+	g.engine.reset()
+}
+
+// survived scores the trail of a player still riding when
+// the board is wiped
+func (g *Game) survived(p *Player) {
+	if p.dead {
+		return
+	}
+	g.scoreTrail(p)
+	g.score.compute()
+	g.save(p)
+}
+
+// startRound resets round scores and respawns all ready players
+func (g *Game) startRound() {
+	// each round is a new replay
+	g.stopRecording()
+	g.startRecording()
+	g.roundEnd = time.Time{}
+	g.winner = nil
+	g.winnerTeam = nil
+	g.result = nil
+	for _, t := range g.teams {
+		t.kills = 0
+	}
+	ready := []*Player{}
+	for _, p := range g.currPlayers {
+		p.roundKills = 0
+		if p.ready {
+			ready = append(ready, p)
+		}
+	}
+	if g.Mode == modeElimination {
+		// not enough players, everyone may respawn freely until there are
+		g.warmup = len(ready) < 2
+		if !g.warmup {
+			g.spawnAll(ready)
+			return
+		}
+	}
+	for _, p := range ready {
+		p.respawn()
+	}
+}
+
+// spawnAll spawns the players at once, spread around the board
+func (g *Game) spawnAll(ps []*Player) {
+	for i, s := range g.engine.spawnPoints(len(ps)) {
+		ps[i].spawn(s)
+	}
+}
+
+// freezing reports whether all players are being reset after a death
+func (g *Game) freezing() bool {
+	return !g.frozen.IsZero()
+}
+
+// freeze stops all cycles after a crash, so everyone can be reset
+func (g *Game) freeze() {
+	g.frozen = time.Now()
+	g.thawed = false
+}
+
+// thaw wipes every trail once the death trail has been
+// shown, then respawns all players after the respawn delay
+func (g *Game) thaw() {
+	frozen := time.Since(g.frozen)
+	if !g.thawed && (frozen >= deathTrail || frozen >= g.RespawnDelay) {
+		g.engine.reset()
+		g.thawed = true
+	}
+	if frozen < g.RespawnDelay {
+		return
+	}
+	g.frozen = time.Time{}
+	ready := []*Player{}
+	for _, p := range g.currPlayers {
+		g.survived(p)
+		p.dead = true
+		p.waiting = false
+		p.cleared = true
+		if p.ready {
+			ready = append(ready, p)
+		}
+	}
+	g.spawnAll(ready)
+}
+
+// renderBanner prepares the lines drawn over the board between rounds
+func (g *Game) renderBanner() {
+	if !g.intermission() {
+		g.banner = nil
+		return
+	}
+	next := roundDelay - time.Since(g.roundEnd)
+	if next < 0 {
+		next = 0
+	}
+	if g.result == nil {
+		g.banner = []string{
+			" GET READY ",
+			"",
+			fmt.Sprintf(" round %d starts in %1.1f ", g.round, next.Seconds()),
+		}
+		return
+	}
+	result := " draw! "
+	if g.winnerTeam != nil {
+		result = fmt.Sprintf(" team %s wins! ", g.winnerTeam.name)
+	} else if g.winner != nil {
+		result = fmt.Sprintf(" %s wins! ", g.winner.Name)
+	}
+	g.banner = []string{
+		fmt.Sprintf(" ROUND %d OVER ", g.result.Round),
+		"",
+		result,
+		"",
+		fmt.Sprintf(" next round in %1.1f ", next.Seconds()),
+	}
+}
+
+// bannerColour is the colour of the banner text
+func (g *Game) bannerColour() ID {
+	if g.winnerTeam != nil {
+		if p := g.teamMember(g.winnerTeam); p != nil {
+			return p.id
+		}
+	} else if g.winner != nil {
+		return g.winner.id
+	}
+	return blank
+}
+
+// overlayRune returns the rune of the lines, centred in a window
+// width by height terminal cells, at location (w, h) of the window
+func (g *Game) overlayRune(lines []string, w, h, width, height int) (rune, bool) {
+	if lines == nil {
+		return empty, false
+	}
+	i := h - (height-len(lines))/2
+	if i < 0 || i >= len(lines) {
+		return empty, false
+	}
+	line := lines[i]
+	j := w - (width-len(line))/2
+	if j < 0 || j >= len(line) {
+		return empty, false
+	}
+	return rune(line[j]), true
+}
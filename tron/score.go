@@ -23,7 +23,7 @@ func (s *scoreboard) compute() {
 		sorted[i] = p
 		i++
 	}
-	sort.Sort(byScore(sorted))
+	sort.Sort(byScore{mode: s.g.Mode, ps: sorted})
 	if s.allPlayersSorted == nil {
 		s.changed = true
 	}
@@ -36,8 +36,7 @@ func (s *scoreboard) compute() {
 		last.rank = 1
 		for i = 1; i < len(sorted); i++ {
 			p := sorted[i]
-			if p.Kills == last.Kills &&
-				p.Deaths == last.Deaths {
+			if compareScore(s.g.Mode, p, last) == 0 {
 				p.rank = last.rank
 			} else {
 				p.rank = last.rank + 1
@@ -49,27 +48,57 @@ func (s *scoreboard) compute() {
 			last = p
 		}
 	}
-	if s.g.bot.connected && s.changed {
+	if s.changed && s.g.botScores() {
 		s.g.bot.scoreChange(sorted)
 	}
 	s.allPlayersSorted = sorted
 }
 
 // byScore implements the sort.Interface to sort the players by score.
-// The scores are first influenced by kills, then deaths and then names.
-type byScore []*Player
+// The scores depend on the game mode (see compareScore) and then names.
+type byScore struct {
+	mode string
+	ps   []*Player
+}
+
+func (s byScore) Len() int      { return len(s.ps) }
+func (s byScore) Swap(i, j int) { s.ps[i], s.ps[j] = s.ps[j], s.ps[i] }
+func (s byScore) Less(i, j int) bool {
+	if c := compareScore(s.mode, s.ps[i], s.ps[j]); c != 0 {
+		return c > 0
+	}
+	return s.ps[i].hash < s.ps[j].hash
+}
+
+// compareScore returns a positive number when a is ahead of b.
+// In kills mode, the scores are first influenced by kills, then deaths.
+// In elimination mode, by round wins, then kills, then deaths.
+// In trail mode, by longest trail, then total trail length.
+func compareScore(mode string, a, b *Player) int {
+	switch mode {
+	case modeElimination:
+		if a.Wins != b.Wins {
+			return a.Wins - b.Wins
+		}
+	case modeTrail:
+		if a.Best != b.Best {
+			return a.Best - b.Best
+		}
+		return a.Points - b.Points
+	}
+	if a.Kills != b.Kills {
+		return a.Kills - b.Kills
+	}
+	return b.Deaths - a.Deaths
+}
 
-func (ps byScore) Len() int      { return len(ps) }
-func (ps byScore) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
-func (ps byScore) Less(i, j int) bool {
-	if ps[i].Kills > ps[j].Kills {
-		return true
-	} else if ps[i].Kills < ps[j].Kills {
-		return false
-	} else if ps[i].Deaths < ps[j].Deaths {
-		return true
-	} else if ps[i].Deaths > ps[j].Deaths {
-		return false
+// headline is the player's main score in the given mode
+func headline(mode string, p *Player) (int, string) {
+	switch mode {
+	case modeElimination:
+		return p.Wins, "wins"
+	case modeTrail:
+		return p.Best, "best trail"
 	}
-	return ps[i].hash < ps[j].hash
+	return p.Kills, "kills"
 }
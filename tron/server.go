@@ -10,10 +10,17 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
+// command (or username) used to watch without playing
+const cmdSpectate = "spectate"
+
+// time to wait for a client to request a shell
+var startTimeout = 10 * time.Second
+
 var (
 	matchip    = regexp.MustCompile(`^\d+\.\d+\.\d+\.\d+`) // TODO: make correct
 	filtername = regexp.MustCompile(`\W`)                  // non-words
@@ -22,16 +29,14 @@ var (
 type Server struct {
 	port       int
 	addresses  string
-	idPool     <-chan ID
 	logf       func(format string, args ...interface{})
 	privateKey ssh.Signer
 	newPlayers chan *Player
 }
 
-func NewServer(db *Database, port int, idPool <-chan ID) (*Server, error) {
+func NewServer(db *Database, port int) (*Server, error) {
 	s := &Server{
 		port:       port,
-		idPool:     idPool,
 		logf:       log.New(os.Stdout, "server: ", 0).Printf,
 		newPlayers: make(chan *Player),
 	}
@@ -91,8 +96,11 @@ func (s *Server) handle(tcpConn *net.TCPConn) {
 	}
 	// global requests must be serviced - discard
 	go ssh.DiscardRequests(globalReqs)
+	// pull the requested glyphs, then team, off the name
+	name, glyphs := parseGlyphs(sshName)
+	name, teamName := parseTeam(name)
 	// protect against XTR (cross terminal renderering) attacks
-	name := filtername.ReplaceAllString(sshName, "")
+	name = filtername.ReplaceAllString(name, "")
 	// trim name
 	maxlen := sidebarWidth - 1
 	if len(name) > maxlen {
@@ -118,55 +126,112 @@ func (s *Server) handle(tcpConn *net.TCPConn) {
 		sshConn.Close()
 		return
 	}
-	// non-blocking pull off the id pool
-	id := ID(0)
-	select {
-	case id, _ = <-s.idPool:
-	default:
-	}
-	// show fullgame error
-	if id == 0 {
-		conn.Write([]byte("This game is full.\r\n"))
-		sshConn.Close()
-		return
-	}
-	// default name using id
-	if name == "" {
-		name = fmt.Sprintf("player-%d", id)
-	}
-	// if user has no public key for some strange reason, use their ip as their unique id
-	if hash == "" {
-		if ip, _, err := net.SplitHostPort(tcpConn.RemoteAddr().String()); err == nil {
-			hash = ip
-		}
-	}
-	p := NewPlayer(id, sshName, name, hash, conn)
+	// service channel requests, buffer resizes until the player is ready
+	resizes := make(chan resize, 8)
+	start := make(chan string, 1)
+	envGlyphs, envTheme, term, colorTerm := "", "", "", ""
 	go func() {
+		started := false
 		for r := range chanReqs {
 			ok := false
 			switch r.Type {
-			case "shell":
-				// We don't accept any commands (Payload),
-				// only the default shell.
-				if len(r.Payload) == 0 {
+			case "shell", "exec":
+				// We accept the default shell (to play)
+				// or a lobby command
+				cmd, valid := parseCommand(r.Type, r.Payload)
+				if valid && !started {
 					ok = true
+					started = true
+					start <- cmd
 				}
 			case "pty-req":
 				// Responding 'ok' here will let the client
 				// know we have a pty ready for input
 				ok = true
 				strlen := r.Payload[3]
-				p.resizes <- parseDims(r.Payload[strlen+4:])
+				if !started {
+					term = string(r.Payload[4 : strlen+4])
+				}
+				resizes <- parseDims(r.Payload[strlen+4:])
+			case "env":
+				// only read once the session starts
+				if key, value, valid := parseEnv(r.Payload); valid && !started {
+					ok = true
+					switch key {
+					case glyphsEnv:
+						envGlyphs = value
+					case themeEnv:
+						envTheme = value
+					case colorTermEnv:
+						colorTerm = value
+					}
+				}
 			case "window-change":
-				p.resizes <- parseDims(r.Payload)
+				resizes <- parseDims(r.Payload)
 				continue // no response
 			}
 			r.Reply(ok, nil)
 		}
+		// session closed, no more resizes
+		close(resizes)
+		if !started {
+			close(start)
+		}
 	}()
+	// wait for the session to start
+	cmd, ok := "", false
+	select {
+	case cmd, ok = <-start:
+	case <-time.After(startTimeout):
+	}
+	if !ok {
+		sshConn.Close()
+		return
+	}
+	// the lobby runs the command, spectators can also use their username
+	if cmd == "" && sshName == cmdSpectate {
+		cmd = cmdSpectate
+	}
+	// if user has no public key for some strange reason, use their ip as their unique id
+	if hash == "" {
+		if ip, _, err := net.SplitHostPort(tcpConn.RemoteAddr().String()); err == nil {
+			hash = ip
+		}
+	}
+	p := NewPlayer(blank, sshName, name, hash, conn)
+	p.teamRequest = teamName
+	// the username beats the environment
+	if gs, ok := findGlyphs(envGlyphs); ok && glyphs == nil {
+		glyphs = gs
+	}
+	if glyphs != nil {
+		p.glyphs = glyphs
+	}
+	p.depth = parseDepth(term, colorTerm)
+	if t, ok := findTheme(envTheme); ok {
+		p.theme = t
+	}
+	p.command = cmd
+	p.resizes = resizes
 	s.newPlayers <- p
 }
 
+// parseCommand extracts the command from a "shell" or "exec" request
+// payload, commands are run by the lobby
+func parseCommand(reqType string, payload []byte) (string, bool) {
+	if reqType == "shell" {
+		return "", len(payload) == 0
+	}
+	if len(payload) < 4 {
+		return "", false
+	}
+	n := binary.BigEndian.Uint32(payload)
+	if uint32(len(payload)-4) < n {
+		return "", false
+	}
+	return strings.TrimSpace(string(payload[4 : 4+n])), true
+}
+
 // parseDims extracts two uint32s from the provided buffer.
 func parseDims(b []byte) resize {
 	if len(b) < 8 {
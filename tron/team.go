@@ -0,0 +1,108 @@
+package tron
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jpillora/ansi"
+)
+
+// team is a group of players sharing a colour and a score
+type team struct {
+	name   string
+	colour []byte
+	kills  int // kills this round
+	wins   int // rounds won
+	points int // trail length
+}
+
+func newTeams(n int) []*team {
+	teams := make([]*team, n)
+	for i := range teams {
+		teams[i] = &team{
+			name:   namedColours[i].name,
+			colour: ansi.Set(namedColours[i].colour),
+		}
+	}
+	return teams
+}
+
+// parseTeam splits an ssh username into a player name and a
+// requested team, either "alice+red" or just "red"
+func parseTeam(sshName string) (name, team string) {
+	if i := strings.LastIndex(sshName, "+"); i >= 0 {
+		return sshName[:i], strings.ToLower(sshName[i+1:])
+	}
+	for _, t := range namedColours {
+		if strings.EqualFold(sshName, t.name) {
+			return sshName, t.name
+		}
+	}
+	return sshName, ""
+}
+
+// assignTeam places the player in their requested team,
+// otherwise in the team with the fewest players
+func (g *Game) assignTeam(p *Player) {
+	if g.teams == nil {
+		return
+	}
+	sizes := map[*team]int{}
+	for _, other := range g.currPlayers {
+		if other != p && other.team != nil {
+			sizes[other.team]++
+		}
+	}
+	p.team = nil
+	for _, t := range g.teams {
+		if t.name == p.teamRequest {
+			p.team = t
+			break
+		}
+		if p.team == nil || sizes[t] < sizes[p.team] {
+			p.team = t
+		}
+	}
+	p.cname = fmt.Sprintf("%s%s%s", p.team.colour, p.Name, ansi.Set(ansi.Reset))
+	p.logf("joined team %s", p.team.name)
+}
+
+// teamLines are the sidebar lines used to show team totals
+func (g *Game) teamLines() int {
+	if g.teams == nil {
+		return 0
+	}
+	return len(g.teams) + 1
+}
+
+// teamScore renders a team's total for the sidebar
+func (g *Game) teamScore(t *team) string {
+	v := t.kills
+	switch g.Mode {
+	case modeElimination:
+		v = t.wins
+	case modeTrail:
+		v = t.points
+	}
+	return fmt.Sprintf("%-8s%5d", t.name, v)
+}
+
+// teamWinner returns the first team to reach the kill limit
+func (g *Game) teamWinner() *team {
+	for _, t := range g.teams {
+		if g.KillLimit > 0 && t.kills >= g.KillLimit {
+			return t
+		}
+	}
+	return nil
+}
+
+// teamMember returns any connected player in the team
+func (g *Game) teamMember(t *team) *Player {
+	for _, p := range g.currPlayers {
+		if p.team == t {
+			return p
+		}
+	}
+	return nil
+}
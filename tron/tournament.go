@@ -0,0 +1,84 @@
+package tron
+
+import "errors"
+
+// Standing is a strategy's record in a tournament
+type Standing struct {
+	Strategy            string
+	Wins, Draws, Losses int
+}
+
+// Tournament plays the named bot strategies against each other, all
+// on the board at once, for the given number of rounds. It runs
+// headless on the engine, so the same seed gives the same standings.
+func Tournament(names []string, rounds, width, height int, seed int64) ([]Standing, error) {
+	if len(names) < 2 {
+		return nil, errors.New("at least 2 strategies are required")
+	}
+	if err := validate(&Config{Width: width, Height: height, GameSpeed: 1, MaxPlayers: len(names)}); err != nil {
+		return nil, err
+	}
+	e, err := newEngine(width, height, seed)
+	if err != nil {
+		return nil, err
+	}
+	standings := make([]Standing, len(names))
+	for i, name := range names {
+		if _, err := newStrategy(name); err != nil {
+			return nil, err
+		}
+		standings[i].Strategy = name
+	}
+	for round := 0; round < rounds; round++ {
+		e.reset()
+		// shuffle the starting points, so no strategy keeps the best one
+		order := e.rand.Perm(len(names))
+		riders := make([]*rider, len(names))
+		strategies := make([]Strategy, len(names))
+		for i, s := range e.spawnPoints(len(names)) {
+			riders[i] = &rider{id: ID(i + 1)}
+			riders[i].spawn(s)
+			strategies[i], _ = newStrategy(names[order[i]])
+		}
+		alive := len(riders)
+		var last []crash
+		// stop once the board could be full
+		for step := 0; alive > 1 && step < width*height; step++ {
+			for i, r := range riders {
+				if !r.dead {
+					r.steer(strategies[i].Steer(e.snapshot(r, riders)))
+				}
+			}
+			if crashes := e.step(riders); len(crashes) > 0 {
+				alive -= len(crashes)
+				last = crashes
+			}
+		}
+		for i, r := range riders {
+			s := &standings[order[i]]
+			switch {
+			case !r.dead && alive == 1:
+				s.Wins++
+			case !r.dead:
+				// out of time
+				s.Draws++
+			case alive == 0 && crashed(r, last):
+				// the last riders crashed together
+				s.Draws++
+			default:
+				s.Losses++
+			}
+		}
+	}
+	return standings, nil
+}
+
+// crashed reports whether r is one of the crashes
+func crashed(r *rider, crashes []crash) bool {
+	for _, c := range crashes {
+		if c.victim == r {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package tron
+
+// smallest part of the board shown to a player, in terminal cells
+const (
+	viewportMinWidth  = 24
+	viewportMinHeight = 12
+)
+
+// viewport is the part of the screen a player's terminal shows. It's
+// the whole board, unless their terminal is too small, then it's a
+// window of the board which follows their cycle.
+type viewport struct {
+	w, h   int // terminal cells, including the sidebar
+	ox, oy int // board column and terminal row at the top left of the window
+}
+
+// fitView sizes the player's view to their terminal,
+// reporting whether the game can be shown at all
+func (p *Player) fitView() bool {
+	g := p.g
+	bw, bh := p.boardSize()
+	if p.w >= sidebarWidth+bw && p.h >= bh {
+		p.view = viewport{w: sidebarWidth + bw, h: bh}
+		return true
+	}
+	if !g.Viewport || p.w < sidebarWidth+viewportMinWidth || p.h < viewportMinHeight {
+		return false
+	}
+	p.view.w, p.view.h = sidebarWidth+bw, bh
+	if p.w < p.view.w {
+		p.view.w = p.w
+	}
+	if p.h < p.view.h {
+		p.view.h = p.h
+	}
+	// centre on the cycle straight away
+	ww, wh := p.window()
+	p.view.ox, p.view.oy = p.x-ww/2, p.y/p.glyphs.rows-wh/2
+	p.follow()
+	return true
+}
+
+// boardSize is the size of the whole board on the player's
+// terminal, in runes
+func (p *Player) boardSize() (int, int) {
+	return p.g.bw * p.glyphs.cols, p.g.bh / p.glyphs.rows
+}
+
+// window is the size of the part of the board shown, in
+// tiles across and runes down
+func (p *Player) window() (int, int) {
+	return (p.view.w - sidebarWidth) / p.glyphs.cols, p.view.h
+}
+
+// minSize is the smallest terminal which can show the game
+func (p *Player) minSize() (int, int) {
+	if p.g.Viewport {
+		return sidebarWidth + viewportMinWidth, viewportMinHeight
+	}
+	bw, bh := p.boardSize()
+	return sidebarWidth + bw, bh
+}
+
+// follow moves the window back towards the player's cycle when
+// it's in the outer quarters, called before each update
+func (p *Player) follow() {
+	v := &p.view
+	ww, wh := p.window()
+	bw, bh := p.g.bw, p.g.bh/p.glyphs.rows
+	if ww >= bw && wh >= bh {
+		v.ox, v.oy = 0, 0
+		return
+	}
+	if p.riding() {
+		x, y := p.x, p.y/p.glyphs.rows
+		if x < v.ox+ww/4 || x >= v.ox+ww-ww/4 {
+			v.ox = x - ww/2
+		}
+		if y < v.oy+wh/4 || y >= v.oy+wh-wh/4 {
+			v.oy = y - wh/2
+		}
+	}
+	v.clamp(bw-ww, bh-wh)
+}
+
+// riding reports whether the player has a cycle on the board
+func (p *Player) riding() bool {
+	return p.id != blank && !p.spectating && !p.dead
+}
+
+// clamp keeps the window on the board
+func (v *viewport) clamp(maxx, maxy int) {
+	if v.ox > maxx {
+		v.ox = maxx
+	}
+	if v.ox < 0 {
+		v.ox = 0
+	}
+	if v.oy > maxy {
+		v.oy = maxy
+	}
+	if v.oy < 0 {
+		v.oy = 0
+	}
+}
+
+// pan moves a spectator's window with the arrow keys
+func (p *Player) pan(d Direction) {
+	ww, wh := p.window()
+	switch d {
+	case dup:
+		p.view.oy -= wh / 2
+	case ddown:
+		p.view.oy += wh / 2
+	case dleft:
+		p.view.ox -= ww / 2
+	case dright:
+		p.view.ox += ww / 2
+	}
+	p.view.clamp(p.g.bw-ww, p.g.bh/p.glyphs.rows-wh)
+}